@@ -149,12 +149,8 @@ func syncNewRepos(cmd *cobra.Command, ctx *workspace.Context, newRepos []manifes
 			continue
 		}
 		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Cloning %s ...\n", r.ID)
-		opts := git.CloneOpts{
-			Depth:        r.EffectiveDepth(ctx.Manifest.Defaults),
-			PartialClone: r.EffectivePartialClone(ctx.Manifest.Defaults),
-			Sparse:       r.Sparse,
-		}
-		if err := git.Clone(r.URL, dir, opts); err != nil {
+		opts := cloneOptions(r, ctx.Manifest.Defaults)
+		if err := git.Clone(cmd.Context(), r.URL, dir, opts); err != nil {
 			_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Warning: failed to clone %s: %v (use 'agentws sync' to retry)\n", r.ID, err)
 		}
 	}
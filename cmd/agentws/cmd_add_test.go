@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -291,7 +292,7 @@ func TestRunAdd_syncSkipsAlreadyCloned(t *testing.T) {
 
 	// Pre-clone.
 	cloneDir := filepath.Join(wsDir, "repos", "precloned")
-	if err := git.Clone(bare, cloneDir, git.CloneOpts{}); err != nil {
+	if err := git.Clone(context.Background(), bare, cloneDir, git.CloneOpts{}); err != nil {
 		t.Fatalf("pre-clone failed: %v", err)
 	}
 
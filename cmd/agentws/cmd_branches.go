@@ -62,22 +62,20 @@ func runBranches(cmd *cobra.Command, _ []string) error {
 			continue
 		}
 
-		branch, err := git.CurrentBranch(dir)
+		st, err := git.Status(dir)
 		if err != nil {
 			bi.Branch = "(error)"
-		} else if branch == "" {
-			bi.Branch = "(detached)"
 		} else {
-			bi.Branch = branch
+			bi.Branch = st.Branch
+			if bi.Branch == "" {
+				bi.Branch = "(detached)"
+			}
+			bi.Dirty = st.Dirty()
 		}
 		head, err := git.HeadCommit(dir)
 		if err == nil {
 			bi.Head = head
 		}
-		dirty, err := git.IsDirty(dir)
-		if err == nil {
-			bi.Dirty = dirty
-		}
 		infos = append(infos, bi)
 	}
 
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fbkclanna/agentws/internal/bundle"
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/lock"
+	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/workspace"
+	"github.com/spf13/cobra"
+)
+
+func newBundleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Create offline workspace bundles",
+	}
+	cmd.AddCommand(newBundleCreateCmd())
+	return cmd
+}
+
+func newBundleCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create <file>",
+		Short: "Write the manifest, lock and a git bundle per repo at the locked commits into one archive",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runBundleCreate,
+	}
+	addLockSelectFlags(cmd)
+	return cmd
+}
+
+func runBundleCreate(cmd *cobra.Command, args []string) error {
+	root, _ := cmd.Flags().GetString("root")
+	file := args[0]
+
+	ctx, err := workspace.Load(root)
+	if err != nil {
+		return err
+	}
+	if err := selectLock(cmd, ctx); err != nil {
+		return err
+	}
+	if ctx.Lock == nil {
+		return fmt.Errorf("no %s found; run agentws pin first", filepath.Base(ctx.LockPath))
+	}
+
+	tmp, err := os.MkdirTemp("", "agentws-bundle-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	w, err := bundle.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := writeBundle(cmd, ctx, w, tmp); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Bundle written to %s (%d repos)\n", file, len(ctx.Lock.Repos))
+	return nil
+}
+
+func writeBundle(cmd *cobra.Command, ctx *workspace.Context, w *bundle.Writer, tmp string) error {
+	if err := w.AddFile(bundle.ManifestName, ctx.ManifestPath); err != nil {
+		return err
+	}
+	if err := w.AddFile(bundle.LockName, ctx.LockPath); err != nil {
+		return err
+	}
+
+	repos := make(map[string]manifest.Repo, len(ctx.Manifest.Repos))
+	for _, r := range ctx.Manifest.Repos {
+		repos[r.ID] = r
+	}
+	out := cmd.OutOrStdout()
+	for _, id := range sortedLockIDs(ctx.Lock) {
+		lr := ctx.Lock.Repos[id]
+		r, ok := repos[id]
+		if !ok {
+			return fmt.Errorf("repo %s is locked but not in workspace.yaml", id)
+		}
+		dir := ctx.RepoDir(r)
+		switch {
+		case !git.IsCloned(dir):
+			return fmt.Errorf("repo %s is not cloned; run agentws sync --lock first", id)
+		case !git.HasCommit(dir, lr.Commit):
+			return fmt.Errorf("repo %s: locked commit %s is not available locally; run agentws sync --lock first", id, lr.Commit)
+		case git.IsShallow(dir):
+			return fmt.Errorf("repo %s is a shallow clone; run git fetch --unshallow in %s first", id, dir)
+		}
+		path := filepath.Join(tmp, id+".bundle")
+		if err := git.CreateBundle(cmd.Context(), dir, lr.Commit, path); err != nil {
+			return fmt.Errorf("repo %s: %w", id, err)
+		}
+		if err := w.AddFile(bundle.RepoName(id), path); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(out, "Bundled %s @ %s\n", id, shortSHA(lr.Commit))
+	}
+	return nil
+}
+
+// restoreBundleRepos clones every locked repo from the extracted bundle in
+// srcDir into the workspace at wsDir, with origin pointing at the manifest URL.
+func restoreBundleRepos(cctx context.Context, out io.Writer, srcDir, wsDir string, ws *manifest.Workspace, lf *lock.File) error {
+	for _, r := range ws.Repos {
+		lr, ok := lf.Repos[r.ID]
+		if !ok {
+			continue
+		}
+		dest := filepath.Join(wsDir, r.Path)
+		if git.IsCloned(dest) {
+			_, _ = fmt.Fprintf(out, "Skipping %s (already cloned)\n", r.ID)
+			continue
+		}
+		src, err := filepath.Abs(filepath.Join(srcDir, filepath.FromSlash(bundle.RepoName(r.ID))))
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(src); err != nil {
+			return fmt.Errorf("repo %s: missing from bundle", r.ID)
+		}
+		// Only branch refs get a local branch; tags and commits are
+		// checked out detached, as sync does.
+		branch := lr.Ref
+		if branch == "" {
+			branch = r.EffectiveRef()
+		}
+		typ := lr.RefType
+		if typ == "" {
+			typ = r.DeclaredRefType()
+		}
+		if typ == manifest.RefTag || typ == manifest.RefCommit {
+			branch = ""
+		}
+		url := r.URL
+		if r.IsLocal() {
+			url = ""
+		}
+		if err := git.CloneBundle(cctx, src, dest, branch, url); err != nil {
+			return fmt.Errorf("repo %s: %w", r.ID, err)
+		}
+		_, _ = fmt.Fprintf(out, "Restored %s @ %s\n", r.ID, shortSHA(lr.Commit))
+	}
+	return nil
+}
+
+func sortedLockIDs(lf *lock.File) []string {
+	ids := make([]string, 0, len(lf.Repos))
+	for id := range lf.Repos {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/lock"
+	"github.com/fbkclanna/agentws/internal/manifest"
+)
+
+func TestBundle_roundTripWithSyncLock(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 2)
+
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync", "--update-lock"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	lf, err := lock.Load(filepath.Join(wsDir, "workspace.lock.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "ws.tar.gz")
+	var buf bytes.Buffer
+	create := newRootCmd()
+	create.SetOut(&buf)
+	create.SetArgs([]string{"--root", wsDir, "bundle", "create", file})
+	if err := create.Execute(); err != nil {
+		t.Fatalf("bundle create failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "(2 repos)") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	// Simulate an air-gapped machine: the canonical remotes are unreachable.
+	for _, bare := range bareRepos {
+		if err := os.RemoveAll(bare); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	target := t.TempDir()
+	initCmd := newRootCmd()
+	initCmd.SetOut(&bytes.Buffer{})
+	initCmd.SetArgs([]string{"--root", target, "init", "restored", "--from-bundle", file, "--no-git"})
+	if err := initCmd.Execute(); err != nil {
+		t.Fatalf("init --from-bundle failed: %v", err)
+	}
+	restored := filepath.Join(target, "restored")
+
+	syncCmd := newRootCmd()
+	syncCmd.SetOut(&bytes.Buffer{})
+	syncCmd.SetErr(&bytes.Buffer{})
+	syncCmd.SetArgs([]string{"--root", restored, "sync", "--lock"})
+	if err := syncCmd.Execute(); err != nil {
+		t.Fatalf("sync --lock in restored workspace failed: %v", err)
+	}
+
+	for i, id := range []string{"backend", "frontend"} {
+		dir := filepath.Join(restored, "repos", id)
+		head, err := git.HeadCommitFull(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head != lf.Repos[id].Commit {
+			t.Errorf("%s: HEAD=%s, want locked %s", id, head, lf.Repos[id].Commit)
+		}
+		url, err := git.RemoteURL(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url != bareRepos[i] {
+			t.Errorf("%s: origin=%s, want canonical %s", id, url, bareRepos[i])
+		}
+	}
+}
+
+func TestBundleCreate_requiresLock(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "bundle", "create", filepath.Join(t.TempDir(), "ws.tar.gz")})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "workspace.lock.yaml") {
+		t.Fatalf("expected missing lock error, got %v", err)
+	}
+}
+
+func TestBundle_restoresTagRefDetached(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+	gitIn(t, bareRepos[0], "tag", "v1.2.0", "main")
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].Ref = "v1.2.0"
+	})
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	lf, err := lock.Load(filepath.Join(wsDir, "workspace.lock.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lf.Repos["backend"].RefType != manifest.RefTag {
+		t.Fatalf("ref_type = %q, want tag", lf.Repos["backend"].RefType)
+	}
+
+	file := filepath.Join(t.TempDir(), "ws.tar.gz")
+	runAgentws(t, "--root", wsDir, "bundle", "create", file)
+	target := t.TempDir()
+	runAgentws(t, "--root", target, "init", "restored", "--from-bundle", file, "--no-git")
+
+	dir := filepath.Join(target, "restored", "repos", "backend")
+	if branch, _ := git.CurrentBranch(dir); branch != "" {
+		t.Errorf("tag ref should be checked out detached, on branch %q", branch)
+	}
+	if head, _ := git.HeadCommitFull(dir); head != lf.Repos["backend"].Commit {
+		t.Errorf("HEAD = %s, want %s", head, lf.Repos["backend"].Commit)
+	}
+	for _, ref := range []string{"refs/heads/v1.2.0", "refs/remotes/origin/v1.2.0"} {
+		if _, err := git.ResolveCommit(dir, ref); err == nil {
+			t.Errorf("%s should not exist", ref)
+		}
+	}
+}
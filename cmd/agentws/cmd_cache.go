@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/fbkclanna/agentws/internal/cache"
+	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/ui"
+	"github.com/fbkclanna/agentws/internal/workspace"
+	"github.com/spf13/cobra"
+)
+
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the shared object cache used by clones",
+	}
+	cmd.AddCommand(
+		newCacheUpdateCmd(),
+		newCacheGCCmd(),
+		newCacheDuCmd(),
+	)
+	return cmd
+}
+
+func newCacheUpdateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "update [id...]",
+		Short: "Create or refresh cache entries for the workspace repos (all if no IDs are given)",
+		RunE:  runCacheUpdate,
+	}
+}
+
+func newCacheGCCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "gc",
+		Short: "Repack cache entries and remove leftovers of interrupted updates",
+		Args:  cobra.NoArgs,
+		RunE:  runCacheGC,
+	}
+}
+
+func newCacheDuCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "du",
+		Short: "Show disk usage of the cache",
+		Args:  cobra.NoArgs,
+		RunE:  runCacheDu,
+	}
+	cmd.Flags().Bool("json", false, "Output as JSON")
+	return cmd
+}
+
+func runCacheUpdate(cmd *cobra.Command, args []string) error {
+	root, _ := cmd.Flags().GetString("root")
+
+	ctx, err := workspace.Load(root)
+	if err != nil {
+		return err
+	}
+	c, err := cache.Default()
+	if err != nil {
+		return err
+	}
+
+	repos := manifest.FilterByIDs(ctx.Manifest.Repos, args, nil)
+	out := cmd.OutOrStdout()
+	for _, r := range repos {
+		if r.IsLocal() {
+			continue
+		}
+		created, err := c.Update(cmd.Context(), r.URL)
+		if err != nil {
+			return fmt.Errorf("repo %s: %w", r.ID, err)
+		}
+		verb := "Updated"
+		if created {
+			verb = "Cached"
+		}
+		_, _ = fmt.Fprintf(out, "%s %s (%s)\n", verb, r.ID, c.Path(r.URL))
+	}
+	return nil
+}
+
+func runCacheGC(cmd *cobra.Command, _ []string) error {
+	c, err := cache.Default()
+	if err != nil {
+		return err
+	}
+	entries, err := c.GC(cmd.Context())
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Repacked %d cached repo(s), %s total.\n", len(entries), formatBytes(totalSize(entries)))
+	return nil
+}
+
+func runCacheDu(cmd *cobra.Command, _ []string) error {
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	c, err := cache.Default()
+	if err != nil {
+		return err
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+
+	if asJSON {
+		if entries == nil {
+			entries = []cache.Entry{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+
+	return printCacheUsage(out, c.Dir, entries)
+}
+
+func printCacheUsage(out io.Writer, dir string, entries []cache.Entry) error {
+	_, _ = fmt.Fprintf(out, "Cache: %s\n\n", dir)
+	tbl := ui.NewTable(out, "SIZE", "URL", "PATH")
+	for _, e := range entries {
+		tbl.Row(formatBytes(e.Size), e.URL, e.Path)
+	}
+	if err := tbl.Flush(); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(out, "\nTotal: %s in %d repo(s)\n", formatBytes(totalSize(entries)), len(entries))
+	return nil
+}
+
+func totalSize(entries []cache.Entry) int64 {
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	return total
+}
+
+// formatBytes renders n using binary units (e.g. "1.5 GiB").
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
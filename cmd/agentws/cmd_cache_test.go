@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fbkclanna/agentws/internal/cache"
+)
+
+func TestRunCache_updateSyncDu(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv(cache.EnvDir, cacheDir)
+	wsDir, bareRepos := setupWorkspace(t, 2)
+
+	var buf bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&buf)
+	root.SetArgs([]string{"--root", wsDir, "cache", "update", "backend"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("cache update failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Cached backend") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	root2 := newRootCmd()
+	root2.SetOut(&bytes.Buffer{})
+	root2.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	alternates := filepath.Join(".git", "objects", "info", "alternates")
+	data, err := os.ReadFile(filepath.Join(wsDir, "repos", "backend", alternates))
+	if err != nil {
+		t.Fatalf("backend should borrow objects from the cache: %v", err)
+	}
+	if !strings.Contains(string(data), cache.Key(bareRepos[0])) {
+		t.Errorf("alternates should point into the cache: %s", data)
+	}
+	if _, err := os.Stat(filepath.Join(wsDir, "repos", "frontend", alternates)); !os.IsNotExist(err) {
+		t.Error("frontend is not cached and should be a plain clone")
+	}
+
+	buf.Reset()
+	du := newRootCmd()
+	du.SetOut(&buf)
+	du.SetArgs([]string{"--root", wsDir, "cache", "du", "--json"})
+	if err := du.Execute(); err != nil {
+		t.Fatalf("cache du failed: %v", err)
+	}
+	var entries []cache.Entry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(entries) != 1 || entries[0].URL != bareRepos[0] {
+		t.Errorf("unexpected cache entries: %+v", entries)
+	}
+}
+
+func TestRunSync_noCache(t *testing.T) {
+	t.Setenv(cache.EnvDir, t.TempDir())
+	wsDir, _ := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "cache", "update"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("cache update failed: %v", err)
+	}
+
+	root2 := newRootCmd()
+	root2.SetOut(&bytes.Buffer{})
+	root2.SetArgs([]string{"--root", wsDir, "sync", "--no-cache"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(wsDir, "repos", "backend", ".git", "objects", "info", "alternates")); !os.IsNotExist(err) {
+		t.Error("--no-cache should not use alternates")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		512:           "512 B",
+		1536:          "1.5 KiB",
+		5 << 30:       "5.0 GiB",
+		3*(1<<20) + 1: "3.0 MiB",
+	}
+	for n, want := range tests {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
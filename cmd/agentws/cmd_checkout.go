@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 
 	"github.com/fbkclanna/agentws/internal/git"
 	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/ui"
 	"github.com/fbkclanna/agentws/internal/workspace"
 	"github.com/spf13/cobra"
 )
@@ -25,6 +28,7 @@ func newCheckoutCmd() *cobra.Command {
 	cmd.Flags().String("strategy", "safe", "Dirty tree strategy: safe, stash, reset")
 	cmd.Flags().Bool("force", false, "Allow destructive operations")
 	cmd.Flags().Bool("dry-run", false, "Show what would happen without making changes")
+	addOutputFlag(cmd)
 	return cmd
 }
 
@@ -44,6 +48,10 @@ func runCheckout(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
+	ndjson, err := ndjsonOutput(cmd)
+	if err != nil {
+		return err
+	}
 	if strategy == workspace.StrategyReset && !force {
 		return fmt.Errorf("--strategy reset requires --force")
 	}
@@ -65,8 +73,15 @@ func runCheckout(cmd *cobra.Command, _ []string) error {
 	repos = manifest.FilterByIDs(repos, only, skip)
 
 	out := cmd.OutOrStdout()
+	// In NDJSON mode the event stream replaces the per-repo text lines.
+	var events *ui.Progress
+	if ndjson {
+		events = ui.NewNDJSONProgress(cmd.OutOrStdout(), len(repos))
+		out = io.Discard
+	}
 	for _, r := range repos {
-		if err := checkoutRepo(ctx, r, branch, create, from, fromExplicit, strategy, dryRun, out); err != nil {
+		if err := checkoutRepo(cmd.Context(), ctx, r, branch, create, from, fromExplicit, strategy, dryRun, out, events); err != nil {
+			events.Finish(r.ID, ui.EventFailed, "", err)
 			return err
 		}
 	}
@@ -74,22 +89,25 @@ func runCheckout(cmd *cobra.Command, _ []string) error {
 	return nil
 }
 
-func checkoutRepo(ctx *workspace.Context, r manifest.Repo, branch string, create bool, from string, fromExplicit bool, strategy workspace.Strategy, dryRun bool, out interface{ Write([]byte) (int, error) }) error {
+func checkoutRepo(cctx context.Context, ctx *workspace.Context, r manifest.Repo, branch string, create bool, from string, fromExplicit bool, strategy workspace.Strategy, dryRun bool, out io.Writer, events *ui.Progress) error {
 	dir := ctx.RepoDir(r)
+	events.Start(r.ID)
 	if !git.IsCloned(dir) {
 		_, _ = fmt.Fprintf(out, "Skipping %s (not cloned)\n", r.ID)
+		events.Finish(r.ID, ui.EventSkipped, "not cloned", nil)
 		return nil
 	}
 
 	if !r.IsLocal() {
-		if err := git.Fetch(dir); err != nil {
+		if err := git.Fetch(cctx, dir); err != nil {
 			return fmt.Errorf("repo %s: fetch: %w", r.ID, err)
 		}
+		events.Step(r.ID, ui.EventFetched, "")
 	}
 
 	// Resolve from before handleDirty to avoid side effects (stash/reset)
 	// when the resolution fails. Only resolves when branch creation is needed.
-	repoFrom, err := resolveFromIfNeeded(dir, branch, create, r, ctx.Manifest.Defaults, from, fromExplicit)
+	repoFrom, err := resolveFromIfNeeded(dir, branch, create, r, ctx.Manifest.Defaults, ctx.Lock, from, fromExplicit)
 	if err != nil {
 		return fmt.Errorf("repo %s: %w", r.ID, err)
 	}
@@ -105,6 +123,7 @@ func checkoutRepo(ctx *workspace.Context, r manifest.Repo, branch string, create
 
 	if dryRun {
 		_, _ = fmt.Fprintf(out, "[dry-run] %s: %s\n", r.ID, action.description)
+		events.Finish(r.ID, ui.EventSkipped, "[dry-run] "+action.description, nil)
 		return nil
 	}
 
@@ -112,6 +131,8 @@ func checkoutRepo(ctx *workspace.Context, r manifest.Repo, branch string, create
 		return fmt.Errorf("repo %s: %w", r.ID, err)
 	}
 	_, _ = fmt.Fprintf(out, "%s: %s\n", r.ID, action.description)
+	events.Step(r.ID, ui.EventCheckedOut, action.description)
+	events.Finish(r.ID, ui.EventDone, action.description, nil)
 	return nil
 }
 
@@ -159,11 +180,11 @@ func resolveCheckoutAction(dir, branch string, create bool, from string, isLocal
 }
 
 func handleDirty(dir, repoID string, strategy workspace.Strategy) error {
-	dirty, err := git.IsDirty(dir)
+	st, err := git.Status(dir)
 	if err != nil {
 		return fmt.Errorf("checking dirty state for %s: %w", repoID, err)
 	}
-	if !dirty {
+	if !st.Dirty() {
 		return nil
 	}
 
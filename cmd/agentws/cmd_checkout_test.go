@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/fbkclanna/agentws/internal/git"
 	"github.com/fbkclanna/agentws/internal/testutil"
+	"github.com/fbkclanna/agentws/internal/ui"
 )
 
 func TestRunCheckout_createBranch(t *testing.T) {
@@ -156,15 +159,16 @@ func TestRunCheckout_noBaseRefNoFromWithCreate(t *testing.T) {
 		t.Fatalf("sync failed: %v", err)
 	}
 
-	// --create without --from and no base_ref → should error
+	// --create without --from and no base_ref → branch from the default branch.
 	root2 := newRootCmd()
 	root2.SetArgs([]string{"--root", wsDir, "checkout", "--branch", "feature/nobase", "--create"})
-	err := root2.Execute()
-	if err == nil {
-		t.Fatal("expected error when base_ref and --from are both unset with --create")
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("checkout --create without base_ref failed: %v", err)
 	}
-	if !strings.Contains(err.Error(), "base_ref is not configured") {
-		t.Errorf("expected error about base_ref not configured, got: %v", err)
+
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if branch, _ := git.CurrentBranch(dir); branch != "feature/nobase" {
+		t.Errorf("expected branch feature/nobase, got %s", branch)
 	}
 }
 
@@ -388,3 +392,34 @@ func TestRunCheckout_localRepo_createBranch(t *testing.T) {
 		t.Errorf("expected branch feature/new, got %s", branch)
 	}
 }
+
+func TestRunCheckout_ndjsonOutput(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	root2 := newRootCmd()
+	root2.SetOut(&buf)
+	root2.SetArgs([]string{"--root", wsDir, "checkout", "--branch", "feature/x", "--create", "--from", "HEAD", "--output", "ndjson"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("checkout --output ndjson failed: %v", err)
+	}
+
+	var types []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e ui.Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("stdout line is not a JSON event: %v: %q", err, line)
+		}
+		types = append(types, e.Type)
+	}
+	want := []string{ui.EventRepoStarted, ui.EventFetched, ui.EventCheckedOut, ui.EventDone}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+}
@@ -7,8 +7,11 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/fbkclanna/agentws/internal/bundle"
 	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/lock"
 	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/workspace"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 )
@@ -21,6 +24,8 @@ func newInitCmd() *cobra.Command {
 		RunE:  runInit,
 	}
 	cmd.Flags().String("from", "", "Import manifest from local path or repo#path")
+	cmd.Flags().String("from-bundle", "", "Recreate the workspace and its repos from a file written by agentws bundle create")
+	cmd.MarkFlagsMutuallyExclusive("from", "from-bundle")
 	cmd.Flags().String("base-ref", "", "Default base branch for feature branches")
 	cmd.Flags().Bool("force", false, "Overwrite existing workspace")
 	cmd.Flags().Bool("no-git", false, "Skip git repository initialization")
@@ -31,6 +36,7 @@ func runInit(cmd *cobra.Command, args []string) error {
 	name := args[0]
 	root, _ := cmd.Flags().GetString("root")
 	from, _ := cmd.Flags().GetString("from")
+	fromBundle, _ := cmd.Flags().GetString("from-bundle")
 	flagBaseRef, _ := cmd.Flags().GetString("base-ref")
 	force, _ := cmd.Flags().GetBool("force")
 	noGit, _ := cmd.Flags().GetBool("no-git")
@@ -40,7 +46,7 @@ func runInit(cmd *cobra.Command, args []string) error {
 	}
 
 	wsDir := filepath.Join(root, name)
-	manifestPath := filepath.Join(wsDir, "workspace.yaml")
+	manifestPath := filepath.Join(wsDir, workspace.ManifestFile)
 
 	if _, err := os.Stat(wsDir); err == nil && !force {
 		return fmt.Errorf("workspace %q already exists (use --force to overwrite)", name)
@@ -49,7 +55,29 @@ func runInit(cmd *cobra.Command, args []string) error {
 	// Build manifest data before creating directory to avoid leaving empty dirs on error.
 	var data []byte
 	var reposRoot string
+	var bundleDir string
+	var bundleWS *manifest.Workspace
 	switch {
+	case fromBundle != "":
+		dir, err := os.MkdirTemp("", "agentws-bundle-")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.RemoveAll(dir) }()
+		if err := bundle.Extract(fromBundle, dir); err != nil {
+			return err
+		}
+		src, err := os.ReadFile(filepath.Join(dir, bundle.ManifestName))
+		if err != nil {
+			return fmt.Errorf("reading manifest from bundle: %w", err)
+		}
+		ws, err := manifest.Parse(src)
+		if err != nil {
+			return fmt.Errorf("invalid manifest in bundle %s: %w", fromBundle, err)
+		}
+		reposRoot = ws.ReposRoot
+		data = src
+		bundleDir, bundleWS = dir, ws
 	case from != "":
 		src, err := fetchFrom(from)
 		if err != nil {
@@ -86,10 +114,29 @@ func runInit(cmd *cobra.Command, args []string) error {
 		initGitRepo(cmd, wsDir, reposRoot)
 	}
 
+	if bundleDir != "" {
+		if err := restoreBundle(cmd, bundleDir, wsDir, bundleWS); err != nil {
+			return err
+		}
+	}
+
 	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Workspace %q created at %s\n", name, wsDir)
 	return nil
 }
 
+// restoreBundle installs the lock from an extracted bundle and restores the
+// locked repos into the new workspace.
+func restoreBundle(cmd *cobra.Command, bundleDir, wsDir string, ws *manifest.Workspace) error {
+	lf, err := lock.Load(filepath.Join(bundleDir, bundle.LockName))
+	if err != nil {
+		return fmt.Errorf("bundle: %w", err)
+	}
+	if err := lock.Save(filepath.Join(wsDir, bundle.LockName), lf); err != nil {
+		return err
+	}
+	return restoreBundleRepos(cmd.Context(), cmd.OutOrStdout(), bundleDir, wsDir, ws, lf)
+}
+
 // interactiveInit runs the interactive workspace creation flow.
 func interactiveInit(name, reposRoot, flagBaseRef string) ([]byte, error) {
 	if !term.IsTerminal(int(os.Stdin.Fd())) {
@@ -149,7 +196,7 @@ func initGitRepo(cmd *cobra.Command, wsDir, reposRoot string) {
 		return
 	}
 
-	if err := git.Add(wsDir, "workspace.yaml", ".gitignore", "AGENTS.md", "CLAUDE.md", "docs/agentws-guide.md"); err != nil {
+	if err := git.Add(wsDir, workspace.ManifestFile, ".gitignore", "AGENTS.md", "CLAUDE.md", "docs/agentws-guide.md"); err != nil {
 		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Warning: git add failed: %v\n", err)
 		return
 	}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fbkclanna/agentws/internal/lock"
+	"github.com/fbkclanna/agentws/internal/ui"
+	"github.com/fbkclanna/agentws/internal/workspace"
+	"github.com/spf13/cobra"
+)
+
+// defaultLockName is the display name of workspace.lock.yaml in lock listings.
+const defaultLockName = "(default)"
+
+func newLockCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Manage named and archived lock files",
+	}
+	cmd.AddCommand(
+		newLockListCmd(),
+		newLockShowCmd(),
+		newLockRmCmd(),
+	)
+	return cmd
+}
+
+func newLockListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the default lock and named locks in .agentws/locks",
+		Args:  cobra.NoArgs,
+		RunE:  runLockList,
+	}
+	cmd.Flags().Bool("json", false, "Output as JSON")
+	return cmd
+}
+
+func newLockShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show [name]",
+		Short: "Show the repos pinned in a lock (default lock if no name is given)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runLockShow,
+	}
+	cmd.Flags().Bool("json", false, "Output as JSON")
+	return cmd
+}
+
+func newLockRmCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <name...>",
+		Short: "Remove named locks from .agentws/locks",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runLockRm,
+	}
+}
+
+// addLockSelectFlags registers --lock-name and --lock-file on commands that
+// read or write a lock file.
+func addLockSelectFlags(cmd *cobra.Command) {
+	cmd.Flags().String("lock-name", "", "Use the named lock .agentws/locks/<name>.lock.yaml")
+	cmd.Flags().String("lock-file", "", "Use the lock file at this path (relative to the workspace root)")
+	cmd.MarkFlagsMutuallyExclusive("lock-name", "lock-file")
+}
+
+// selectLock points ctx at the lock selected by --lock-name/--lock-file.
+func selectLock(cmd *cobra.Command, ctx *workspace.Context) error {
+	name, _ := cmd.Flags().GetString("lock-name")
+	file, _ := cmd.Flags().GetString("lock-file")
+	if name == "" && file == "" {
+		return nil
+	}
+	path, err := ctx.ResolveLockPath(name, file)
+	if err != nil {
+		return err
+	}
+	return ctx.UseLock(path)
+}
+
+type lockSummary struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	GeneratedAt string `json:"generated_at,omitempty"`
+	Repos       int    `json:"repos"`
+}
+
+func runLockList(cmd *cobra.Command, _ []string) error {
+	root, _ := cmd.Flags().GetString("root")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	ctx, err := workspace.Load(root)
+	if err != nil {
+		return err
+	}
+
+	var summaries []lockSummary
+	if ctx.Lock != nil {
+		summaries = append(summaries, summarizeLock(ctx, defaultLockName, ctx.LockPath, ctx.Lock))
+	}
+	named, err := ctx.ListLocks()
+	if err != nil {
+		return err
+	}
+	for _, nl := range named {
+		lf, err := lock.Load(nl.Path)
+		if err != nil {
+			return fmt.Errorf("lock %s: %w", nl.Name, err)
+		}
+		summaries = append(summaries, summarizeLock(ctx, nl.Name, nl.Path, lf))
+	}
+
+	out := cmd.OutOrStdout()
+
+	if asJSON {
+		if summaries == nil {
+			summaries = []lockSummary{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summaries)
+	}
+
+	tbl := ui.NewTable(out, "NAME", "REPOS", "GENERATED", "PATH")
+	for _, s := range summaries {
+		tbl.Row(s.Name, s.Repos, s.GeneratedAt, s.Path)
+	}
+	return tbl.Flush()
+}
+
+func summarizeLock(ctx *workspace.Context, name, path string, lf *lock.File) lockSummary {
+	if rel, err := filepath.Rel(ctx.Root, path); err == nil {
+		path = rel
+	}
+	return lockSummary{
+		Name:        name,
+		Path:        path,
+		GeneratedAt: lf.GeneratedAt,
+		Repos:       len(lf.Repos),
+	}
+}
+
+func runLockShow(cmd *cobra.Command, args []string) error {
+	root, _ := cmd.Flags().GetString("root")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	ctx, err := workspace.Load(root)
+	if err != nil {
+		return err
+	}
+
+	path := ctx.LockPath
+	if len(args) == 1 && args[0] != defaultLockName {
+		path, err = ctx.LockNamePath(args[0])
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("lock %s not found", filepath.Base(path))
+	}
+	lf, err := lock.Load(path)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(lf)
+	}
+
+	_, _ = fmt.Fprintf(out, "Name:      %s\n", lf.Name)
+	_, _ = fmt.Fprintf(out, "Generated: %s\n", lf.GeneratedAt)
+	_, _ = fmt.Fprintf(out, "Tool:      %s\n\n", lf.ToolVersion)
+
+	ids := make([]string, 0, len(lf.Repos))
+	for id := range lf.Repos {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	tbl := ui.NewTable(out, "REPO", "REF", "COMMIT", "URL")
+	for _, id := range ids {
+		lr := lf.Repos[id]
+		tbl.Row(id, lr.Ref, shortSHA(lr.Commit), lr.URL)
+	}
+	return tbl.Flush()
+}
+
+func runLockRm(cmd *cobra.Command, args []string) error {
+	root, _ := cmd.Flags().GetString("root")
+
+	ctx, err := workspace.Load(root)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	for _, name := range args {
+		if name == defaultLockName {
+			return fmt.Errorf("refusing to remove the default lock; delete workspace.lock.yaml manually")
+		}
+		path, err := ctx.LockNamePath(name)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("lock %q not found", name)
+			}
+			return fmt.Errorf("removing lock %q: %w", name, err)
+		}
+		_, _ = fmt.Fprintf(out, "Removed lock %s\n", name)
+	}
+	return nil
+}
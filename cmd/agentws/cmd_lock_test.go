@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/lock"
+	"github.com/fbkclanna/agentws/internal/testutil"
+)
+
+func TestRunPin_lockName(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	root2 := newRootCmd()
+	root2.SetArgs([]string{"--root", wsDir, "pin", "--lock-name", "release-2.3"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("pin --lock-name failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(wsDir, "workspace.lock.yaml")); err == nil {
+		t.Error("default lock should not be written when --lock-name is given")
+	}
+	lf, err := lock.Load(filepath.Join(wsDir, ".agentws", "locks", "release-2.3.lock.yaml"))
+	if err != nil {
+		t.Fatalf("named lock not written: %v", err)
+	}
+	if lf.Repos["backend"] == nil {
+		t.Error("backend should be pinned in the named lock")
+	}
+}
+
+func TestRunPin_lockNameAndFileExclusive(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "pin", "--lock-name", "a", "--lock-file", "b.yaml"})
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected error when both --lock-name and --lock-file are given")
+	}
+}
+
+func TestRunPin_archive(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync", "--update-lock"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	root2 := newRootCmd()
+	root2.SetArgs([]string{"--root", wsDir, "pin", "--archive"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("pin --archive failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(wsDir, ".agentws", "locks"))
+	if err != nil {
+		t.Fatalf("locks directory not created: %v", err)
+	}
+	if len(entries) != 1 || !strings.HasPrefix(entries[0].Name(), "workspace.") {
+		t.Errorf("expected one archived workspace lock, got %v", entries)
+	}
+}
+
+func TestRunSync_lockName(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("initial sync failed: %v", err)
+	}
+
+	root2 := newRootCmd()
+	root2.SetArgs([]string{"--root", wsDir, "pin", "--lock-name", "incident-0917"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("pin failed: %v", err)
+	}
+
+	dir := filepath.Join(wsDir, "repos", "backend")
+	pinned, err := git.HeadCommitFull(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.PushNewCommit(t, bareRepos[0])
+
+	// A plain sync moves to the new commit.
+	root3 := newRootCmd()
+	root3.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root3.Execute(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	root4 := newRootCmd()
+	root4.SetArgs([]string{"--root", wsDir, "sync", "--lock", "--lock-name", "incident-0917"})
+	if err := root4.Execute(); err != nil {
+		t.Fatalf("sync --lock --lock-name failed: %v", err)
+	}
+
+	current, err := git.HeadCommitFull(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != pinned {
+		t.Errorf("expected HEAD=%s (named lock), got %s", pinned[:7], current[:7])
+	}
+}
+
+func TestRunSync_lockNameMissing(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync", "--lock", "--lock-name", "nope"})
+	err := root.Execute()
+	if err == nil {
+		t.Fatal("expected error for missing named lock")
+	}
+	if !strings.Contains(err.Error(), "nope.lock.yaml") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRunLock_listShowRm(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync", "--update-lock"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	root2 := newRootCmd()
+	root2.SetArgs([]string{"--root", wsDir, "pin", "--lock-name", "release-2.3"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("pin failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	list := newRootCmd()
+	list.SetOut(&buf)
+	list.SetArgs([]string{"--root", wsDir, "lock", "list", "--json"})
+	if err := list.Execute(); err != nil {
+		t.Fatalf("lock list failed: %v", err)
+	}
+	var summaries []lockSummary
+	if err := json.Unmarshal(buf.Bytes(), &summaries); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].Name != defaultLockName || summaries[1].Name != "release-2.3" {
+		t.Errorf("unexpected lock list: %+v", summaries)
+	}
+
+	buf.Reset()
+	show := newRootCmd()
+	show.SetOut(&buf)
+	show.SetArgs([]string{"--root", wsDir, "lock", "show", "release-2.3"})
+	if err := show.Execute(); err != nil {
+		t.Fatalf("lock show failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "backend") {
+		t.Errorf("lock show output missing backend: %s", buf.String())
+	}
+
+	rm := newRootCmd()
+	rm.SetOut(&bytes.Buffer{})
+	rm.SetArgs([]string{"--root", wsDir, "lock", "rm", "release-2.3"})
+	if err := rm.Execute(); err != nil {
+		t.Fatalf("lock rm failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(wsDir, ".agentws", "locks", "release-2.3.lock.yaml")); !os.IsNotExist(err) {
+		t.Error("named lock should be removed")
+	}
+
+	rm2 := newRootCmd()
+	rm2.SetArgs([]string{"--root", wsDir, "lock", "rm", "release-2.3"})
+	if err := rm2.Execute(); err == nil {
+		t.Error("expected error removing a missing lock")
+	}
+}
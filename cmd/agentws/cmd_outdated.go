@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/ui"
+	"github.com/fbkclanna/agentws/internal/workspace"
+	"github.com/spf13/cobra"
+)
+
+func newOutdatedCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "outdated",
+		Short: "Show repos with new upstream commits since the lock or HEAD",
+		Long: `Compare the upstream commit of each repo's ref (read with git ls-remote)
+with the locked commit and the local HEAD, without changing branches or the
+worktree. To count new commits, missing upstream commits are fetched into
+remote-tracking refs (disable with --no-fetch).
+
+A repo is outdated when upstream has commits that are not in its locked
+commit, or in HEAD for repos that are not in the lock.`,
+		RunE: runOutdated,
+	}
+	cmd.Flags().Bool("json", false, "Output as JSON")
+	cmd.Flags().Bool("check", false, "Exit non-zero if any repo is outdated or cannot be checked")
+	cmd.Flags().Bool("no-fetch", false, "Only compare commit IDs; do not fetch to count new commits")
+	cmd.Flags().Int("jobs", 4, "Number of repos checked in parallel")
+	cmd.Flags().String("profile", "", "Filter by profile")
+	cmd.Flags().StringSlice("only", nil, "Include only these repo IDs")
+	cmd.Flags().StringSlice("skip", nil, "Exclude these repo IDs")
+	addLockSelectFlags(cmd)
+	return cmd
+}
+
+type outdatedRepo struct {
+	ID       string `json:"id"`
+	Ref      string `json:"ref,omitempty"`
+	RefType  string `json:"ref_type,omitempty"`
+	Upstream string `json:"upstream,omitempty"`
+	Lock     string `json:"lock,omitempty"`
+	Head     string `json:"head,omitempty"`
+	// Commits in upstream that are not in the lock / HEAD; nil when they
+	// could not be counted (not fetched, or not cloned).
+	NewSinceLock *int   `json:"new_since_lock,omitempty"`
+	NewSinceHead *int   `json:"new_since_head,omitempty"`
+	Newest       string `json:"newest,omitempty"`
+	Outdated     bool   `json:"outdated"`
+	Skipped      string `json:"skipped,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+func runOutdated(cmd *cobra.Command, _ []string) error {
+	root, _ := cmd.Flags().GetString("root")
+	asJSON, _ := cmd.Flags().GetBool("json")
+	check, _ := cmd.Flags().GetBool("check")
+	noFetch, _ := cmd.Flags().GetBool("no-fetch")
+	jobs, _ := cmd.Flags().GetInt("jobs")
+	profile, _ := cmd.Flags().GetString("profile")
+	only, _ := cmd.Flags().GetStringSlice("only")
+	skip, _ := cmd.Flags().GetStringSlice("skip")
+
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be >= 1 (got %d)", jobs)
+	}
+
+	ctx, err := workspace.Load(root)
+	if err != nil {
+		return err
+	}
+	if err := selectLock(cmd, ctx); err != nil {
+		return err
+	}
+
+	repos := ctx.Manifest.Repos
+	if profile != "" {
+		repos, err = manifest.FilterRepos(ctx.Manifest, profile)
+		if err != nil {
+			return err
+		}
+	}
+	repos = manifest.FilterByIDs(repos, only, skip)
+
+	results := collectOutdated(cmd.Context(), ctx, repos, jobs, noFetch)
+
+	out := cmd.OutOrStdout()
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else if err := printOutdated(out, results); err != nil {
+		return err
+	}
+
+	if !check {
+		return nil
+	}
+	var outdated, failed int
+	for _, o := range results {
+		if o.Outdated {
+			outdated++
+		}
+		if o.Error != "" {
+			failed++
+		}
+	}
+	cmd.SilenceUsage = true
+	switch {
+	case failed > 0:
+		return fmt.Errorf("%d repo(s) outdated, %d could not be checked", outdated, failed)
+	case outdated > 0:
+		return fmt.Errorf("%d repo(s) outdated: %s", outdated, outdatedSummary(results))
+	}
+	return nil
+}
+
+// collectOutdated checks repos with up to jobs workers and returns the
+// results in manifest order. A worker holds its repo's slot of the host
+// limits only while talking to origin, so local work such as counting new
+// commits does not hold up other repos of the same host.
+func collectOutdated(cctx context.Context, ctx *workspace.Context, repos []manifest.Repo, jobs int, noFetch bool) []outdatedRepo {
+	hosts := newHostLimiter(ctx.Manifest.Defaults.HostLimits)
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	results := make([]outdatedRepo, len(repos))
+	for i, r := range repos {
+		wg.Add(1)
+		go func(i int, r manifest.Repo) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = checkOutdated(cctx, ctx, r, noFetch, hosts.slot(r.URL))
+		}(i, r)
+	}
+	wg.Wait()
+	return results
+}
+
+// checkOutdated compares r's upstream commit with its lock and HEAD. Talking
+// to origin holds hostSlot (nil = unlimited).
+func checkOutdated(cctx context.Context, ctx *workspace.Context, r manifest.Repo, noFetch bool, hostSlot chan struct{}) outdatedRepo {
+	o := outdatedRepo{ID: r.ID}
+	if r.IsLocal() {
+		o.Skipped = "local repo"
+		return o
+	}
+	dir := ctx.RepoDir(r)
+	cloned := git.IsCloned(dir)
+	r = withResolvedRef(dir, r, ctx.Lock)
+	o.Ref = r.EffectiveRef()
+	if ctx.Lock != nil {
+		if lr, ok := ctx.Lock.Repos[r.ID]; ok {
+			o.Lock = lr.Commit
+		}
+	}
+	if cloned {
+		o.Head, _ = git.HeadCommitFull(dir)
+	}
+
+	typ := r.DeclaredRefType()
+	if typ == "" && cloned {
+		typ = detectRefType(dir, r)
+	}
+	if typ == manifest.RefCommit {
+		o.RefType = typ
+		o.Skipped = "pinned to a commit"
+		return o
+	}
+
+	// ls-remote through origin of the clone, or the manifest URL before
+	// the repo is cloned.
+	lsDir, remote := dir, "origin"
+	if !cloned {
+		lsDir, remote = ".", r.URL
+	}
+	var refs map[string]string
+	err := withHostSlot(cctx, hostSlot, func() error {
+		var err error
+		refs, err = git.LsRemote(cctx, lsDir, remote, "refs/heads/"+o.Ref, "refs/tags/"+o.Ref, "refs/tags/"+o.Ref+"^{}")
+		return err
+	})
+	if err != nil {
+		o.Error = err.Error()
+		return o
+	}
+	o.Upstream, o.RefType = pickRemoteRef(refs, o.Ref, typ)
+	if o.Upstream == "" {
+		o.Error = fmt.Sprintf("ref %s not found on origin", o.Ref)
+		return o
+	}
+
+	if cloned && !noFetch && !git.HasCommit(dir, o.Upstream) {
+		err = withHostSlot(cctx, hostSlot, func() error {
+			if o.RefType == manifest.RefBranch {
+				return git.FetchTrackingBranch(cctx, dir, o.Ref)
+			}
+			return git.FetchCommit(cctx, dir, o.Upstream, 0)
+		})
+		if err != nil {
+			o.Error = fmt.Sprintf("fetching %s: %v", o.Ref, err)
+			return o
+		}
+	}
+
+	if cloned && git.HasCommit(dir, o.Upstream) {
+		o.NewSinceLock = countNew(dir, o.Lock, o.Upstream)
+		o.NewSinceHead = countNew(dir, o.Head, o.Upstream)
+	}
+
+	base, n := o.Lock, o.NewSinceLock
+	if base == "" {
+		base, n = o.Head, o.NewSinceHead
+	}
+	o.Outdated = base != "" && base != o.Upstream && (n == nil || *n > 0)
+	if base != o.Upstream && cloned && git.HasCommit(dir, o.Upstream) {
+		o.Newest, _ = git.CommitSubject(dir, o.Upstream)
+	}
+	return o
+}
+
+// pickRemoteRef chooses the commit of ref from ls-remote output: the branch
+// or the (peeled) tag, depending on typ, preferring a branch when typ is
+// unknown.
+func pickRemoteRef(refs map[string]string, ref, typ string) (sha, refType string) {
+	tag := refs["refs/tags/"+ref+"^{}"]
+	if tag == "" {
+		tag = refs["refs/tags/"+ref]
+	}
+	branch := refs["refs/heads/"+ref]
+	switch {
+	case typ != manifest.RefTag && branch != "":
+		return branch, manifest.RefBranch
+	case typ != manifest.RefBranch && tag != "":
+		return tag, manifest.RefTag
+	}
+	return "", typ
+}
+
+// countNew returns the number of commits in upstream that are not in base,
+// or nil if base is empty or not available locally.
+func countNew(dir, base, upstream string) *int {
+	if base == "" || !git.HasCommit(dir, base) {
+		return nil
+	}
+	n, err := git.CountCommits(dir, base, upstream)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+func printOutdated(out io.Writer, results []outdatedRepo) error {
+	tbl := ui.NewTable(out, "REPO", "STATUS", "REF", "UPSTREAM", "LOCK", "HEAD", "NEWEST")
+	outdated := 0
+	for _, o := range results {
+		switch {
+		case o.Skipped != "":
+			tbl.Row(o.ID, "skipped", o.Ref, "", "", "", o.Skipped)
+			continue
+		case o.Error != "":
+			tbl.Row(o.ID, "error", o.Ref, "", "", "", o.Error)
+			continue
+		}
+		status := "up to date"
+		if o.Outdated {
+			status = "outdated"
+			outdated++
+		}
+		ref := o.Ref
+		if o.RefType == manifest.RefTag {
+			ref = "tag " + ref
+		}
+		tbl.Row(o.ID, status, ref, shortSHA(o.Upstream),
+			newCommitsLabel(o.Lock, o.NewSinceLock, o.Upstream),
+			newCommitsLabel(o.Head, o.NewSinceHead, o.Upstream),
+			o.Newest)
+	}
+	if err := tbl.Flush(); err != nil {
+		return err
+	}
+	if outdated == 0 {
+		_, _ = fmt.Fprintln(out, "All checked repos are up to date.")
+		return nil
+	}
+	_, _ = fmt.Fprintf(out, "%d repo(s) outdated.\n", outdated)
+	return nil
+}
+
+// newCommitsLabel describes how far upstream is from base, e.g. "+3".
+func newCommitsLabel(base string, n *int, upstream string) string {
+	switch {
+	case base == "":
+		return "-"
+	case base == upstream:
+		return "="
+	case n == nil:
+		return "differs"
+	case *n == 0:
+		return "ahead"
+	}
+	return fmt.Sprintf("+%d", *n)
+}
+
+// outdatedSummary lists the IDs of outdated repos, for messages.
+func outdatedSummary(results []outdatedRepo) string {
+	var ids []string
+	for _, o := range results {
+		if o.Outdated {
+			ids = append(ids, o.ID)
+		}
+	}
+	return strings.Join(ids, ", ")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/testutil"
+	"github.com/fbkclanna/agentws/internal/workspace"
+)
+
+func TestRunOutdated(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 3)
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	testutil.PushNewCommits(t, bareRepos[0], 2)
+	// infra is locked but not cloned; its upstream still matches the lock.
+	if err := os.RemoveAll(filepath.Join(wsDir, "repos", "infra")); err != nil {
+		t.Fatal(err)
+	}
+	backend := filepath.Join(wsDir, "repos", "backend")
+	headBefore, err := git.HeadCommitFull(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := runAgentws(t, "--root", wsDir, "outdated", "--json")
+	var results []outdatedRepo
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	b := results[0]
+	if !b.Outdated || b.RefType != manifest.RefBranch || b.Newest != "new commit" {
+		t.Errorf("backend: %+v", b)
+	}
+	if b.NewSinceLock == nil || *b.NewSinceLock != 2 || b.NewSinceHead == nil || *b.NewSinceHead != 2 {
+		t.Errorf("backend: expected 2 new commits since lock and HEAD, got %v / %v", b.NewSinceLock, b.NewSinceHead)
+	}
+	if f := results[1]; f.Outdated || f.Error != "" || f.Upstream != f.Lock {
+		t.Errorf("frontend should be up to date: %+v", f)
+	}
+	if i := results[2]; i.Outdated || i.Error != "" || i.Head != "" || i.NewSinceLock != nil {
+		t.Errorf("infra (not cloned) should be compared by commit only: %+v", i)
+	}
+
+	// Nothing but remote-tracking refs changed.
+	if head, _ := git.HeadCommitFull(backend); head != headBefore {
+		t.Errorf("outdated moved HEAD from %s to %s", headBefore, head)
+	}
+	if !git.HasCommit(backend, b.Upstream) {
+		t.Error("upstream commit should have been fetched for counting")
+	}
+
+	text := runAgentws(t, "--root", wsDir, "outdated")
+	if !strings.Contains(text, "+2") || !strings.Contains(text, "1 repo(s) outdated.") {
+		t.Errorf("unexpected table:\n%s", text)
+	}
+}
+
+func TestRunOutdated_check(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 2)
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	runAgentws(t, "--root", wsDir, "outdated", "--check")
+
+	testutil.PushNewCommit(t, bareRepos[1])
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "outdated", "--check", "--no-fetch"})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "1 repo(s) outdated: frontend") {
+		t.Errorf("expected outdated error for frontend, got %v", err)
+	}
+}
+
+func TestPickRemoteRef(t *testing.T) {
+	refs := map[string]string{
+		"refs/heads/v1":      "b",
+		"refs/tags/v1":       "t",
+		"refs/tags/v1^{}":    "c",
+		"refs/tags/v2":       "d",
+		"refs/heads/release": "e",
+	}
+	tests := []struct {
+		ref, typ, sha, refType string
+	}{
+		{"v1", "", "b", manifest.RefBranch},
+		{"v1", manifest.RefTag, "c", manifest.RefTag},
+		{"v2", "", "d", manifest.RefTag},
+		{"release", manifest.RefTag, "", manifest.RefTag},
+		{"missing", "", "", ""},
+	}
+	for _, tt := range tests {
+		sha, refType := pickRemoteRef(refs, tt.ref, tt.typ)
+		if sha != tt.sha || refType != tt.refType {
+			t.Errorf("pickRemoteRef(%q, %q) = %q, %q; want %q, %q", tt.ref, tt.typ, sha, refType, tt.sha, tt.refType)
+		}
+	}
+}
+
+// lsRemoteCounter is a git runner that fails every ls-remote after a short
+// delay and records the peak number of concurrent calls per host.
+type lsRemoteCounter struct {
+	mu   sync.Mutex
+	cur  map[string]int
+	peak map[string]int
+}
+
+func (c *lsRemoteCounter) Run(_ context.Context, cmd git.Cmd) error {
+	if len(cmd.Args) < 2 || cmd.Args[0] != "ls-remote" {
+		return errors.New("unexpected git call")
+	}
+	host := git.URLHost(cmd.Args[1])
+	c.mu.Lock()
+	c.cur[host]++
+	c.peak[host] = max(c.peak[host], c.cur[host])
+	c.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	c.mu.Lock()
+	c.cur[host]--
+	c.mu.Unlock()
+	return errors.New("ls-remote failed")
+}
+
+func TestCollectOutdated_hostLimits(t *testing.T) {
+	ws := &manifest.Workspace{
+		Version:   1,
+		Name:      "test",
+		ReposRoot: "repos",
+		Defaults:  manifest.Defaults{HostLimits: map[string]int{"github.com": 1}},
+	}
+	for i := range 6 {
+		url := fmt.Sprintf("git@github.com:org/r%d.git", i)
+		if i >= 3 {
+			url = fmt.Sprintf("https://gitlab.example.com/org/r%d.git", i)
+		}
+		ws.Repos = append(ws.Repos, manifest.Repo{ID: fmt.Sprintf("r%d", i), URL: url, Path: fmt.Sprintf("repos/r%d", i), Ref: "main"})
+	}
+	ctx := &workspace.Context{Root: t.TempDir(), Manifest: ws}
+
+	counter := &lsRemoteCounter{cur: map[string]int{}, peak: map[string]int{}}
+	defer git.SetRunner(git.SetRunner(counter))
+
+	results := collectOutdated(context.Background(), ctx, ws.Repos, 6, false)
+	for _, o := range results {
+		if o.Error == "" {
+			t.Errorf("%s: expected the ls-remote error", o.ID)
+		}
+	}
+	if got := counter.peak["github.com"]; got != 1 {
+		t.Errorf("peak concurrent github.com ls-remotes = %d, want 1", got)
+	}
+	if got := counter.peak["gitlab.example.com"]; got != 3 {
+		t.Errorf("peak concurrent gitlab.example.com ls-remotes = %d, want 3 (unlimited)", got)
+	}
+}
@@ -2,60 +2,191 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/fbkclanna/agentws/internal/git"
 	"github.com/fbkclanna/agentws/internal/lock"
+	"github.com/fbkclanna/agentws/internal/manifest"
 	"github.com/fbkclanna/agentws/internal/workspace"
 	"github.com/spf13/cobra"
 )
 
 func newPinCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "pin",
 		Short: "Pin current HEAD commits to the lock file",
-		RunE:  runPin,
+		Long: `Record the current HEAD commit of each cloned repo in the lock file.
+
+Entries are merged into the existing lock: repos outside the selection and
+repos that are not cloned keep their locked commits. Use --replace to write
+a lock that contains only the repos pinned now.
+
+With --commit (or defaults.commit_lock in the manifest) the lock is committed
+to the workspace git repository, listing the repos whose commit changed.`,
+		RunE: runPin,
 	}
+	addLockSelectFlags(cmd)
+	cmd.Flags().Bool("archive", false, "Archive the previous lock under .agentws/locks before overwriting")
+	cmd.Flags().String("profile", "", "Pin only repos matching the profile")
+	cmd.Flags().StringSlice("only", nil, "Pin only these repo IDs")
+	cmd.Flags().StringSlice("skip", nil, "Do not pin these repo IDs")
+	cmd.Flags().Bool("replace", false, "Replace the lock instead of merging into it")
+	addLockCommitFlags(cmd)
+	return cmd
 }
 
 func runPin(cmd *cobra.Command, _ []string) error {
 	root, _ := cmd.Flags().GetString("root")
+	archive, _ := cmd.Flags().GetBool("archive")
+	profile, _ := cmd.Flags().GetString("profile")
+	only, _ := cmd.Flags().GetStringSlice("only")
+	skip, _ := cmd.Flags().GetStringSlice("skip")
+	replace, _ := cmd.Flags().GetBool("replace")
 
 	ctx, err := workspace.Load(root)
 	if err != nil {
 		return err
 	}
+	if err := selectLock(cmd, ctx); err != nil {
+		return err
+	}
+
+	repos := ctx.Manifest.Repos
+	if profile != "" {
+		repos, err = manifest.FilterRepos(ctx.Manifest, profile)
+		if err != nil {
+			return err
+		}
+	}
+	repos = manifest.FilterByIDs(repos, only, skip)
+
+	lf, sum, err := buildLock(ctx, repos, replace)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	for _, id := range sum.pinned {
+		_, _ = fmt.Fprintf(out, "Pinned %s @ %s\n", id, shortSHA(lf.Repos[id].Commit))
+	}
+	for _, id := range sum.skipped {
+		if lr, ok := lf.Repos[id]; ok {
+			_, _ = fmt.Fprintf(out, "Skipping %s (not cloned; keeping %s)\n", id, shortSHA(lr.Commit))
+		} else {
+			_, _ = fmt.Fprintf(out, "Skipping %s (not cloned)\n", id)
+		}
+	}
+	printDirtyWarning(out, sum)
+	for _, id := range sum.dropped {
+		_, _ = fmt.Fprintf(out, "Dropped %s (no longer in the manifest)\n", id)
+	}
+	if sum.kept > 0 {
+		_, _ = fmt.Fprintf(out, "Kept %d other locked repo(s)\n", sum.kept)
+	}
+
+	if archive {
+		name, err := ctx.ArchiveLock(ctx.LockPath)
+		if err != nil {
+			return err
+		}
+		if name != "" {
+			_, _ = fmt.Fprintf(out, "Previous lock archived as %s\n", name)
+		}
+	}
+
+	if err := lock.Save(ctx.LockPath, lf); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(out, "Lock file written to %s\n", ctx.LockPath)
+	if lc := lockCommitSettings(cmd, ctx); lc.commit {
+		return commitLock(cmd.Context(), ctx, lc, out)
+	}
+	return nil
+}
+
+// pinSummary describes how buildLock arrived at the new lock.
+type pinSummary struct {
+	pinned  []string // repos recorded at their current HEAD
+	skipped []string // selected repos that are not cloned
+	dropped []string // previous entries of repos no longer in the manifest
+	dirty   []string // pinned repos with uncommitted changes
+	kept    int      // previous entries of repos outside the selection
+}
 
+// buildLock records the current HEAD of every cloned repo in repos. Unless
+// replace is set, the result is merged into ctx.Lock: entries of other repos,
+// and of selected repos that are not cloned, are kept. Entries of repos that
+// are no longer in the manifest are dropped either way. Used by pin and
+// sync --update-lock.
+func buildLock(ctx *workspace.Context, repos []manifest.Repo, replace bool) (*lock.File, pinSummary, error) {
 	lf := &lock.File{
-		Version:     1,
+		Version:     lock.Version,
 		Name:        ctx.Manifest.Name,
 		GeneratedAt: time.Now().Format(time.RFC3339),
 		ToolVersion: version,
 		Repos:       make(map[string]*lock.Repo, len(ctx.Manifest.Repos)),
 	}
+	var sum pinSummary
 
-	for _, r := range ctx.Manifest.Repos {
+	if !replace && ctx.Lock != nil {
+		inManifest := make(map[string]bool, len(ctx.Manifest.Repos))
+		for _, r := range ctx.Manifest.Repos {
+			inManifest[r.ID] = true
+		}
+		selected := make(map[string]bool, len(repos))
+		for _, r := range repos {
+			selected[r.ID] = true
+		}
+		for _, id := range sortedLockIDs(ctx.Lock) {
+			switch {
+			case !inManifest[id]:
+				sum.dropped = append(sum.dropped, id)
+			case !selected[id]:
+				sum.kept++
+				fallthrough
+			default:
+				lf.Repos[id] = ctx.Lock.Repos[id]
+			}
+		}
+	}
+
+	for _, r := range repos {
 		dir := ctx.RepoDir(r)
 		if !git.IsCloned(dir) {
-			fmt.Printf("Skipping %s (not cloned)\n", r.ID)
+			sum.skipped = append(sum.skipped, r.ID)
 			continue
 		}
-		commit, err := git.HeadCommitFull(dir)
+		lr, err := lockEntry(dir, r, ctx.Lock)
 		if err != nil {
-			return fmt.Errorf("reading HEAD for %s: %w", r.ID, err)
+			return nil, sum, err
 		}
-		lf.Repos[r.ID] = &lock.Repo{
-			URL:    r.URL,
-			Ref:    r.EffectiveRef(),
-			Commit: commit,
+		lf.Repos[r.ID] = lr
+		sum.pinned = append(sum.pinned, r.ID)
+		if lr.Dirty {
+			sum.dirty = append(sum.dirty, r.ID)
 		}
-		fmt.Printf("Pinned %s @ %s\n", r.ID, commit[:minLen(len(commit), 7)])
 	}
 
-	if err := lock.Save(ctx.LockPath, lf); err != nil {
-		return err
+	// Entries kept from a lock older than schema 2 record no clone state.
+	// Keep that lock's version so they are not read as full clones.
+	if ctx.Lock != nil && ctx.Lock.Version < lf.Version {
+		for id, lr := range lf.Repos {
+			if lr == ctx.Lock.Repos[id] {
+				lf.Version = ctx.Lock.Version
+				break
+			}
+		}
 	}
+	return lf, sum, nil
+}
 
-	fmt.Printf("Lock file written to %s\n", ctx.LockPath)
-	return nil
+// printDirtyWarning warns that uncommitted changes of pinned repos are not
+// part of the lock.
+func printDirtyWarning(out io.Writer, sum pinSummary) {
+	if len(sum.dirty) > 0 {
+		_, _ = fmt.Fprintf(out, "Warning: %s had uncommitted changes; the lock records HEAD only\n", strings.Join(sum.dirty, ", "))
+	}
 }
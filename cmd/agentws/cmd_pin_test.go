@@ -2,10 +2,16 @@ package main
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/fbkclanna/agentws/internal/git"
 	"github.com/fbkclanna/agentws/internal/lock"
+	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/testutil"
 )
 
 func TestRunPin_createsLock(t *testing.T) {
@@ -73,3 +79,237 @@ func TestRunPin_skipsUncloned(t *testing.T) {
 		t.Error("expected backend to be in lock file")
 	}
 }
+
+func TestRunPin_mergesIntoLock(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 3)
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	lockPath := filepath.Join(wsDir, "workspace.lock.yaml")
+	before, err := lock.Load(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// infra is no longer cloned; backend and frontend move upstream.
+	if err := os.RemoveAll(filepath.Join(wsDir, "repos", "infra")); err != nil {
+		t.Fatal(err)
+	}
+	testutil.PushNewCommit(t, bareRepos[0])
+	testutil.PushNewCommit(t, bareRepos[1])
+	runAgentws(t, "--root", wsDir, "sync", "--only", "backend,frontend")
+
+	out := runAgentws(t, "--root", wsDir, "pin", "--skip", "frontend")
+	for _, want := range []string{"Pinned backend", "Skipping infra (not cloned; keeping", "Kept 1 other locked repo(s)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("pin output missing %q:\n%s", want, out)
+		}
+	}
+	after, err := lock.Load(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Repos["backend"].Commit == before.Repos["backend"].Commit {
+		t.Error("backend should be pinned at its new HEAD")
+	}
+	for _, id := range []string{"frontend", "infra"} {
+		if after.Repos[id] == nil || after.Repos[id].Commit != before.Repos[id].Commit {
+			t.Errorf("%s: entry should be kept unchanged, got %+v", id, after.Repos[id])
+		}
+	}
+
+	// sync --update-lock with a filter merges the same way.
+	runAgentws(t, "--root", wsDir, "sync", "--only", "frontend", "--update-lock")
+	after, err = lock.Load(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Repos["frontend"].Commit == before.Repos["frontend"].Commit || len(after.Repos) != 3 {
+		t.Errorf("update-lock --only frontend should update frontend and keep the rest: %+v", after.Repos)
+	}
+
+	runAgentws(t, "--root", wsDir, "pin", "--replace")
+	after, err = lock.Load(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := after.Repos["infra"]; ok || len(after.Repos) != 2 {
+		t.Errorf("pin --replace should drop the uncloned infra entry: %+v", after.Repos)
+	}
+}
+
+func TestRunPin_dropsReposRemovedFromManifest(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos = ws.Repos[:1]
+	})
+
+	out := runAgentws(t, "--root", wsDir, "pin")
+	if !strings.Contains(out, "Dropped frontend (no longer in the manifest)") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	lf, err := lock.Load(filepath.Join(wsDir, "workspace.lock.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lf.Repos["frontend"]; ok {
+		t.Error("frontend should be dropped from the lock")
+	}
+}
+
+func TestRunPin_recordsCloneState(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync")
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if err := git.SparseCheckoutSet(dir, []string{"docs"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "scratch.txt"), []byte("wip\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runAgentws(t, "--root", wsDir, "pin")
+	if !strings.Contains(out, "Warning: backend had uncommitted changes") {
+		t.Errorf("expected dirty warning:\n%s", out)
+	}
+
+	lf, err := lock.Load(filepath.Join(wsDir, "workspace.lock.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lf.Version != lock.Version {
+		t.Errorf("version = %d, want %d", lf.Version, lock.Version)
+	}
+	lr := lf.Repos["backend"]
+	if lr.Branch != "main" || lr.CommitTime == "" || !lr.Dirty || lr.Depth != 0 {
+		t.Errorf("unexpected clone state: %+v", lr)
+	}
+	if lr.Sparse == nil || !lr.Sparse.Cone || len(lr.Sparse.Paths) != 1 || lr.Sparse.Paths[0] != "docs" {
+		t.Errorf("sparse = %+v, want cone [docs]", lr.Sparse)
+	}
+}
+
+func TestRunPin_keepsVersionOfOlderEntries(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	lockPath := filepath.Join(wsDir, "workspace.lock.yaml")
+	lf, err := lock.Load(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf.Version = 1
+	if err := lock.Save(lockPath, lf); err != nil {
+		t.Fatal(err)
+	}
+
+	// frontend keeps its v1 entry, so the lock must stay at version 1.
+	runAgentws(t, "--root", wsDir, "pin", "--only", "backend")
+	if lf, err = lock.Load(lockPath); err != nil {
+		t.Fatal(err)
+	}
+	if lf.Version != 1 {
+		t.Errorf("version = %d, want 1 while v1 entries are kept", lf.Version)
+	}
+
+	runAgentws(t, "--root", wsDir, "pin")
+	if lf, err = lock.Load(lockPath); err != nil {
+		t.Fatal(err)
+	}
+	if lf.Version != lock.Version {
+		t.Errorf("version = %d, want %d after pinning every repo", lf.Version, lock.Version)
+	}
+}
+
+func TestRunPin_commit(t *testing.T) {
+	wsDir, bares := setupWorkspace(t, 2)
+	if err := git.Init(wsDir); err != nil {
+		t.Fatal(err)
+	}
+	runAgentws(t, "--root", wsDir, "sync")
+
+	out := runAgentws(t, "--root", wsDir, "pin", "--commit")
+	if !strings.Contains(out, "Committed workspace.lock.yaml (2 repo(s) changed)") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	msg := lastCommitMessage(t, wsDir)
+	if !strings.HasPrefix(msg, "Update workspace.lock.yaml: backend, frontend\n") || !strings.Contains(msg, "backend   (new) -> ") {
+		t.Errorf("unexpected commit message:\n%s", msg)
+	}
+
+	// Only backend moves.
+	backend := filepath.Join(wsDir, "repos", "backend")
+	old, err := git.HeadCommitFull(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.PushNewCommit(t, bares[0])
+	runAgentws(t, "--root", wsDir, "sync")
+	cur, err := git.HeadCommitFull(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runAgentws(t, "--root", wsDir, "pin", "--commit")
+	msg = lastCommitMessage(t, wsDir)
+	want := "Update workspace.lock.yaml: backend\n\nbackend  " + shortSHA(old) + " -> " + shortSHA(cur) + "\n"
+	if msg != want {
+		t.Errorf("commit message = %q, want %q", msg, want)
+	}
+
+	time.Sleep(time.Second) // so the rewritten lock gets a new generated_at
+	out = runAgentws(t, "--root", wsDir, "pin", "--commit")
+	if !strings.Contains(out, "No locked commits changed") {
+		t.Errorf("expected no commit when nothing changed:\n%s", out)
+	}
+	// The rewritten lock (new generated_at) must not be left behind.
+	if st := strings.TrimSpace(gitIn(t, wsDir, "status", "--porcelain", "--", "workspace.lock.yaml")); st != "" {
+		t.Errorf("workspace repo should be clean after a no-op commit, got %q", st)
+	}
+}
+
+func TestRunPin_commitLockDefaultAndPush(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Defaults.CommitLock = true
+	})
+	// Make the workspace a clone of its own remote so the commit can be
+	// pushed.
+	remote := testutil.CreateBareRepo(t)
+	if err := git.Init(wsDir); err != nil {
+		t.Fatal(err)
+	}
+	gitIn(t, wsDir, "remote", "add", "origin", remote)
+	gitIn(t, wsDir, "fetch", "--quiet", "origin")
+	gitIn(t, wsDir, "checkout", "--quiet", "-b", "main", "--track", "origin/main")
+	runAgentws(t, "--root", wsDir, "sync")
+
+	out := runAgentws(t, "--root", wsDir, "pin", "--commit=false")
+	if strings.Contains(out, "Committed") {
+		t.Errorf("--commit=false should override commit_lock:\n%s", out)
+	}
+
+	out = runAgentws(t, "--root", wsDir, "pin", "--push")
+	if !strings.Contains(out, "Pushed lock commit.") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	head, err := git.HeadCommitFull(wsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed, err := git.ResolveCommit(remote, "refs/heads/main"); err != nil || pushed != head {
+		t.Errorf("remote main = %s (err %v), want %s", pushed, err, head)
+	}
+}
+
+// lastCommitMessage returns the full message of HEAD in dir.
+func lastCommitMessage(t *testing.T, dir string) string {
+	t.Helper()
+	return gitIn(t, dir, "log", "-1", "--format=%B")
+}
+
+func gitIn(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimRight(string(out), "\n") + "\n"
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/workspace"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func newPruneCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove repos under repos_root that are no longer in the manifest",
+		RunE:  runPrune,
+	}
+	cmd.Flags().Bool("yes", false, "Delete without asking for confirmation")
+	cmd.Flags().Bool("force", false, "Also delete dirty repos and repos with unpushed branches")
+	cmd.Flags().Bool("dry-run", false, "List unmanaged repos without deleting them")
+	return cmd
+}
+
+func runPrune(cmd *cobra.Command, _ []string) error {
+	root, _ := cmd.Flags().GetString("root")
+	yes, _ := cmd.Flags().GetBool("yes")
+	force, _ := cmd.Flags().GetBool("force")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	ctx, err := workspace.Load(root)
+	if err != nil {
+		return err
+	}
+	return pruneRepos(ctx, cmd.OutOrStdout(), yes, force, "--force", dryRun)
+}
+
+// pruneCandidate is a git repo under repos_root that no manifest entry points to.
+type pruneCandidate struct {
+	dir    string
+	rel    string
+	reason string // why deletion is refused without --force; empty if safe
+}
+
+// pruneRepos lists unmanaged repos under repos_root and deletes them after
+// confirmation (or --yes). Dirty repos and repos with unpushed branches are
+// kept unless force is set; forceFlag names the flag that sets it.
+func pruneRepos(ctx *workspace.Context, out io.Writer, yes, force bool, forceFlag string, dryRun bool) error {
+	dirs, err := ctx.FindUnmanagedRepos()
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		_, _ = fmt.Fprintln(out, "No unmanaged repos found.")
+		return nil
+	}
+
+	var deletable []pruneCandidate
+	_, _ = fmt.Fprintln(out, "Unmanaged repos:")
+	for _, dir := range dirs {
+		c := inspectPruneCandidate(ctx, dir)
+		switch {
+		case c.reason == "":
+			_, _ = fmt.Fprintf(out, "  %s\n", c.rel)
+			deletable = append(deletable, c)
+		case force:
+			_, _ = fmt.Fprintf(out, "  %s (%s, %s)\n", c.rel, c.reason, forceFlag)
+			deletable = append(deletable, c)
+		default:
+			_, _ = fmt.Fprintf(out, "  %s (%s, kept; use %s to delete)\n", c.rel, c.reason, forceFlag)
+		}
+	}
+
+	if dryRun || len(deletable) == 0 {
+		return nil
+	}
+
+	if !yes {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			_, _ = fmt.Fprintln(out, "Re-run with --yes to delete them.")
+			return nil
+		}
+		ok, err := promptConfirm(fmt.Sprintf("Delete %d unmanaged repo(s)?", len(deletable)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			_, _ = fmt.Fprintln(out, "Aborted.")
+			return nil
+		}
+	}
+
+	for _, c := range deletable {
+		if err := os.RemoveAll(c.dir); err != nil {
+			return fmt.Errorf("removing %s: %w", c.rel, err)
+		}
+		_, _ = fmt.Fprintf(out, "Removed %s\n", c.rel)
+	}
+	return nil
+}
+
+func inspectPruneCandidate(ctx *workspace.Context, dir string) pruneCandidate {
+	c := pruneCandidate{dir: dir, rel: dir}
+	if rel, err := filepath.Rel(ctx.Root, dir); err == nil {
+		c.rel = rel
+	}
+
+	var reasons []string
+	dirty, err := git.IsDirty(dir)
+	if err != nil {
+		reasons = append(reasons, "cannot read status")
+	} else if dirty {
+		reasons = append(reasons, "dirty")
+	}
+	branches, err := git.UnpushedBranches(dir)
+	if err != nil {
+		reasons = append(reasons, "cannot read branches")
+	} else if len(branches) > 0 {
+		reasons = append(reasons, "unpushed: "+strings.Join(branches, ", "))
+	}
+	c.reason = strings.Join(reasons, "; ")
+	return c
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/manifest"
+)
+
+// dropRepoFromManifest syncs the workspace and then removes the given repo
+// from workspace.yaml, leaving its clone behind.
+func dropRepoFromManifest(t *testing.T, wsDir, id string) {
+	t.Helper()
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	path := filepath.Join(wsDir, "workspace.yaml")
+	ws, err := manifest.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []manifest.Repo
+	for _, r := range ws.Repos {
+		if r.ID != id {
+			kept = append(kept, r)
+		}
+	}
+	ws.Repos = kept
+	if err := manifest.Save(path, ws); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunPrune_yes(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	dropRepoFromManifest(t, wsDir, "frontend")
+
+	var buf bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&buf)
+	root.SetArgs([]string{"--root", wsDir, "prune", "--yes"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+
+	if git.IsCloned(filepath.Join(wsDir, "repos", "frontend")) {
+		t.Error("frontend should be removed")
+	}
+	if !git.IsCloned(filepath.Join(wsDir, "repos", "backend")) {
+		t.Error("backend should be kept")
+	}
+	if !strings.Contains(buf.String(), "Removed repos/frontend") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestRunPrune_withoutYesOnlyLists(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	dropRepoFromManifest(t, wsDir, "frontend")
+
+	var buf bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&buf)
+	root.SetArgs([]string{"--root", wsDir, "prune"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+
+	if !git.IsCloned(filepath.Join(wsDir, "repos", "frontend")) {
+		t.Error("frontend should not be removed without confirmation")
+	}
+	if !strings.Contains(buf.String(), "repos/frontend") {
+		t.Errorf("frontend should be listed: %s", buf.String())
+	}
+}
+
+func TestRunPrune_dirtyRequiresForce(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	dropRepoFromManifest(t, wsDir, "frontend")
+
+	dir := filepath.Join(wsDir, "repos", "frontend")
+	if err := os.WriteFile(filepath.Join(dir, "dirty.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "prune", "--yes"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	if !git.IsCloned(dir) {
+		t.Fatal("dirty repo should be kept without --force")
+	}
+
+	root2 := newRootCmd()
+	root2.SetOut(&bytes.Buffer{})
+	root2.SetArgs([]string{"--root", wsDir, "prune", "--yes", "--force"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("prune --force failed: %v", err)
+	}
+	if git.IsCloned(dir) {
+		t.Error("dirty repo should be removed with --force")
+	}
+}
+
+func TestRunPrune_unpushedRequiresForce(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	dropRepoFromManifest(t, wsDir, "frontend")
+
+	dir := filepath.Join(wsDir, "repos", "frontend")
+	if err := os.WriteFile(filepath.Join(dir, "local.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Add(dir, "local.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Commit(dir, "local commit"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&buf)
+	root.SetArgs([]string{"--root", wsDir, "prune", "--yes"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	if !git.IsCloned(dir) {
+		t.Error("repo with unpushed commits should be kept without --force")
+	}
+	if !strings.Contains(buf.String(), "unpushed: main") {
+		t.Errorf("expected unpushed reason in output: %s", buf.String())
+	}
+}
+
+func TestRunSync_prune(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	dropRepoFromManifest(t, wsDir, "frontend")
+
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync", "--prune", "--yes"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync --prune failed: %v", err)
+	}
+	if git.IsCloned(filepath.Join(wsDir, "repos", "frontend")) {
+		t.Error("frontend should be pruned by sync --prune")
+	}
+}
+
+func TestRunSync_pruneDirtyRequiresPruneForce(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	dropRepoFromManifest(t, wsDir, "frontend")
+
+	dir := filepath.Join(wsDir, "repos", "frontend")
+	if err := os.WriteFile(filepath.Join(dir, "dirty.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// --force is for the dirty strategy of managed repos; it does not let
+	// prune delete a dirty unmanaged repo.
+	var buf bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&buf)
+	root.SetArgs([]string{"--root", wsDir, "sync", "--strategy", "reset", "--force", "--prune", "--yes"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync --prune failed: %v", err)
+	}
+	if !git.IsCloned(dir) {
+		t.Fatal("dirty repo should be kept without --prune-force")
+	}
+	if !strings.Contains(buf.String(), "use --prune-force to delete") {
+		t.Errorf("expected a hint to --prune-force: %s", buf.String())
+	}
+
+	root = newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync", "--prune", "--prune-force", "--yes"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync --prune --prune-force failed: %v", err)
+	}
+	if git.IsCloned(dir) {
+		t.Error("dirty repo should be removed with --prune-force")
+	}
+}
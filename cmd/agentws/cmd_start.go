@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/lock"
 	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/ui"
 	"github.com/fbkclanna/agentws/internal/workspace"
 	"github.com/spf13/cobra"
 )
@@ -25,6 +29,7 @@ func newStartCmd() *cobra.Command {
 	cmd.Flags().String("strategy", "safe", "Dirty tree strategy: safe, stash, reset")
 	cmd.Flags().Bool("force", false, "Allow destructive operations")
 	cmd.Flags().Bool("dry-run", false, "Show what would happen without making changes")
+	addOutputFlag(cmd)
 	return cmd
 }
 
@@ -43,6 +48,10 @@ func runStart(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	ndjson, err := ndjsonOutput(cmd)
+	if err != nil {
+		return err
+	}
 	if strategy == workspace.StrategyReset && !force {
 		return fmt.Errorf("--strategy reset requires --force")
 	}
@@ -54,8 +63,6 @@ func runStart(cmd *cobra.Command, args []string) error {
 	}
 
 	branch := buildBranchName(prefix, ticket, slug)
-	out := cmd.OutOrStdout()
-	_, _ = fmt.Fprintf(out, "Branch: %s\n", branch)
 
 	fromExplicit := cmd.Flags().Changed("from")
 
@@ -73,8 +80,18 @@ func runStart(cmd *cobra.Command, args []string) error {
 	}
 	repos = manifest.FilterByIDs(repos, only, skip)
 
+	// In NDJSON mode the event stream replaces the per-repo text lines.
+	out := cmd.OutOrStdout()
+	var events *ui.Progress
+	if ndjson {
+		events = ui.NewNDJSONProgress(cmd.OutOrStdout(), len(repos))
+		out = io.Discard
+	}
+	_, _ = fmt.Fprintf(out, "Branch: %s\n", branch)
+	events.Log("Branch: %s", branch)
 	for _, r := range repos {
-		if err := startRepo(ctx, r, branch, from, fromExplicit, strategy, dryRun, out); err != nil {
+		if err := startRepo(cmd.Context(), ctx, r, branch, from, fromExplicit, strategy, dryRun, out, events); err != nil {
+			events.Finish(r.ID, ui.EventFailed, "", err)
 			return err
 		}
 	}
@@ -82,22 +99,25 @@ func runStart(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func startRepo(ctx *workspace.Context, r manifest.Repo, branch, from string, fromExplicit bool, strategy workspace.Strategy, dryRun bool, out interface{ Write([]byte) (int, error) }) error {
+func startRepo(cctx context.Context, ctx *workspace.Context, r manifest.Repo, branch, from string, fromExplicit bool, strategy workspace.Strategy, dryRun bool, out io.Writer, events *ui.Progress) error {
 	dir := ctx.RepoDir(r)
+	events.Start(r.ID)
 	if !git.IsCloned(dir) {
 		_, _ = fmt.Fprintf(out, "Skipping %s (not cloned)\n", r.ID)
+		events.Finish(r.ID, ui.EventSkipped, "not cloned", nil)
 		return nil
 	}
 
 	if !r.IsLocal() {
-		if err := git.Fetch(dir); err != nil {
+		if err := git.Fetch(cctx, dir); err != nil {
 			return fmt.Errorf("repo %s: fetch: %w", r.ID, err)
 		}
+		events.Step(r.ID, ui.EventFetched, "")
 	}
 
 	// Resolve from before handleDirty to avoid side effects (stash/reset)
 	// when the resolution fails. Only resolves when branch creation is needed.
-	repoFrom, err := resolveFromIfNeeded(dir, branch, true, r, ctx.Manifest.Defaults, from, fromExplicit)
+	repoFrom, err := resolveFromIfNeeded(dir, branch, true, r, ctx.Manifest.Defaults, ctx.Lock, from, fromExplicit)
 	if err != nil {
 		return fmt.Errorf("repo %s: %w", r.ID, err)
 	}
@@ -113,6 +133,7 @@ func startRepo(ctx *workspace.Context, r manifest.Repo, branch, from string, fro
 
 	if dryRun {
 		_, _ = fmt.Fprintf(out, "[dry-run] %s: %s\n", r.ID, action.description)
+		events.Finish(r.ID, ui.EventSkipped, "[dry-run] "+action.description, nil)
 		return nil
 	}
 
@@ -120,13 +141,15 @@ func startRepo(ctx *workspace.Context, r manifest.Repo, branch, from string, fro
 		return fmt.Errorf("repo %s: %w", r.ID, err)
 	}
 	_, _ = fmt.Fprintf(out, "%s: %s\n", r.ID, action.description)
+	events.Step(r.ID, ui.EventCheckedOut, action.description)
+	events.Finish(r.ID, ui.EventDone, action.description, nil)
 	return nil
 }
 
 // resolveFromIfNeeded checks whether the branch needs to be created and, if so,
 // resolves the starting point. Called before handleDirty so that config errors
 // are returned before any side effects (stash/reset).
-func resolveFromIfNeeded(dir, branch string, create bool, r manifest.Repo, d manifest.Defaults, cliFrom string, cliSpecified bool) (string, error) {
+func resolveFromIfNeeded(dir, branch string, create bool, r manifest.Repo, d manifest.Defaults, lf *lock.File, cliFrom string, cliSpecified bool) (string, error) {
 	if !create {
 		return cliFrom, nil
 	}
@@ -146,16 +169,27 @@ func resolveFromIfNeeded(dir, branch string, create bool, r manifest.Repo, d man
 			return "", nil
 		}
 	}
-	return resolveStartFrom(r, d, cliFrom, cliSpecified)
+	return resolveStartFrom(dir, r, d, lf, cliFrom, cliSpecified)
 }
 
-func resolveStartFrom(r manifest.Repo, d manifest.Defaults, cliFrom string, cliSpecified bool) (string, error) {
+// resolveStartFrom returns the starting point for a new branch: --from, the
+// configured base_ref, or else the repo's default branch, which must exist.
+func resolveStartFrom(dir string, r manifest.Repo, d manifest.Defaults, lf *lock.File, cliFrom string, cliSpecified bool) (string, error) {
 	if cliSpecified {
 		return cliFrom, nil
 	}
 	base := r.EffectiveBaseRef(d)
 	if base == "" {
-		return "", fmt.Errorf("base_ref is not configured (set base_ref in workspace.yaml or use --from)")
+		base = defaultBranch(dir, r, lf)
+		var exists bool
+		if r.IsLocal() {
+			exists, _ = git.BranchExists(dir, base)
+		} else {
+			exists, _ = git.RemoteBranchExists(dir, base)
+		}
+		if !exists {
+			return "", fmt.Errorf("base_ref is not configured and the default branch %s was not found (set base_ref in workspace.yaml or use --from)", base)
+		}
 	}
 	if r.IsLocal() {
 		return base, nil
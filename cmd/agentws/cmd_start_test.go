@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/manifest"
 	"github.com/fbkclanna/agentws/internal/testutil"
 )
 
@@ -508,24 +509,43 @@ func TestRunStart_noUpstreamToBaseBranch(t *testing.T) {
 	}
 }
 
-func TestRunStart_noBaseRefNoFromError(t *testing.T) {
-	wsDir, _ := setupWorkspace(t, 1)
+func TestRunStart_noBaseRefUsesDefaultBranch(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+	// The remote's default branch is develop, not main.
+	for _, args := range [][]string{
+		{"-C", bareRepos[0], "branch", "develop", "main"},
+		{"-C", bareRepos[0], "symbolic-ref", "HEAD", "refs/heads/develop"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].Ref = ""
+	})
 
 	root := newRootCmd()
 	root.SetArgs([]string{"--root", wsDir, "sync"})
 	if err := root.Execute(); err != nil {
 		t.Fatalf("sync failed: %v", err)
 	}
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if branch, _ := git.CurrentBranch(dir); branch != "develop" {
+		t.Fatalf("sync without ref should check out the default branch, got %s", branch)
+	}
 
-	// No --from, no base_ref in workspace.yaml → should error
+	// No --from, no base_ref in workspace.yaml → branch from origin/develop.
 	root2 := newRootCmd()
 	root2.SetArgs([]string{"--root", wsDir, "start", "NOBASE-1", "test"})
-	err := root2.Execute()
-	if err == nil {
-		t.Fatal("expected error when base_ref and --from are both unset")
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("start failed: %v", err)
 	}
-	if !strings.Contains(err.Error(), "base_ref is not configured") {
-		t.Errorf("expected error about base_ref not configured, got: %v", err)
+	out, err := exec.Command("git", "-C", dir, "config", "branch.feature/NOBASE-1-test.merge").Output()
+	if err == nil && strings.TrimSpace(string(out)) != "refs/heads/develop" {
+		t.Errorf("unexpected upstream %q", strings.TrimSpace(string(out)))
+	}
+	if branch, _ := git.CurrentBranch(dir); branch != "feature/NOBASE-1-test" {
+		t.Errorf("expected branch feature/NOBASE-1-test, got %s", branch)
 	}
 }
 
@@ -575,13 +595,17 @@ func TestRunStart_noBaseRef_stashNotApplied(t *testing.T) {
 		t.Fatalf("sync failed: %v", err)
 	}
 
-	// Make the repo dirty.
+	// Make the repo dirty and point origin/HEAD at a branch that does not
+	// exist, so the default branch cannot be used as base.
 	dir := filepath.Join(wsDir, "repos", "backend")
 	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("dirty\n"), 0644); err != nil {
 		t.Fatal(err)
 	}
+	if out, err := exec.Command("git", "-C", dir, "symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/missing").CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
 
-	// No --from, no base_ref, --strategy stash → should error about base_ref
+	// No --from, no usable base, --strategy stash → should error about base_ref
 	// WITHOUT stashing first (no side effects before config error).
 	root2 := newRootCmd()
 	root2.SetArgs([]string{"--root", wsDir, "start", "STASH-NOBASE-1", "test", "--strategy", "stash"})
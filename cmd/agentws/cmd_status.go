@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/fbkclanna/agentws/internal/git"
 	"github.com/fbkclanna/agentws/internal/manifest"
@@ -18,33 +20,64 @@ func newStatusCmd() *cobra.Command {
 		RunE:  runStatus,
 	}
 	cmd.Flags().Bool("json", false, "Output as JSON")
+	cmd.Flags().Int("jobs", 4, "Number of repos inspected in parallel")
+	cmd.Flags().String("profile", "", "Filter by profile")
+	cmd.Flags().StringSlice("only", nil, "Include only these repo IDs")
+	cmd.Flags().StringSlice("skip", nil, "Exclude these repo IDs")
 	return cmd
 }
 
 type repoStatus struct {
-	ID       string `json:"id"`
-	Local    bool   `json:"local,omitempty"`
-	Cloned   bool   `json:"cloned"`
-	Branch   string `json:"branch,omitempty"`
-	Head     string `json:"head,omitempty"`
-	Dirty    bool   `json:"dirty"`
-	LockDiff string `json:"lock_diff,omitempty"`
+	ID         string   `json:"id"`
+	Local      bool     `json:"local,omitempty"`
+	Cloned     bool     `json:"cloned"`
+	Branch     string   `json:"branch,omitempty"`
+	Head       string   `json:"head,omitempty"`
+	Ref        string   `json:"ref,omitempty"`
+	RefType    string   `json:"ref_type,omitempty"`
+	RefMatch   bool     `json:"ref_match"`
+	InProgress string   `json:"in_progress,omitempty"`
+	Stashes    int      `json:"stashes,omitempty"`
+	Dirty      bool     `json:"dirty"`
+	Staged     int      `json:"staged,omitempty"`
+	Modified   int      `json:"modified,omitempty"`
+	Untracked  int      `json:"untracked,omitempty"`
+	Conflicted int      `json:"conflicted,omitempty"`
+	Upstream   string   `json:"upstream,omitempty"`
+	Gone       bool     `json:"upstream_gone,omitempty"`
+	Ahead      int      `json:"ahead,omitempty"`
+	Behind     int      `json:"behind,omitempty"`
+	LockDiff   string   `json:"lock_diff,omitempty"`
+	Drift      []string `json:"drift,omitempty"`
 }
 
 func runStatus(cmd *cobra.Command, _ []string) error {
 	root, _ := cmd.Flags().GetString("root")
 	asJSON, _ := cmd.Flags().GetBool("json")
+	jobs, _ := cmd.Flags().GetInt("jobs")
+	profile, _ := cmd.Flags().GetString("profile")
+	only, _ := cmd.Flags().GetStringSlice("only")
+	skip, _ := cmd.Flags().GetStringSlice("skip")
+
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be >= 1 (got %d)", jobs)
+	}
 
 	ctx, err := workspace.Load(root)
 	if err != nil {
 		return err
 	}
 
-	statuses := make([]repoStatus, 0, len(ctx.Manifest.Repos))
-	for _, r := range ctx.Manifest.Repos {
-		s := collectStatus(ctx, r)
-		statuses = append(statuses, s)
+	repos := ctx.Manifest.Repos
+	if profile != "" {
+		repos, err = manifest.FilterRepos(ctx.Manifest, profile)
+		if err != nil {
+			return err
+		}
 	}
+	repos = manifest.FilterByIDs(repos, only, skip)
+
+	statuses := collectStatuses(ctx, repos, jobs)
 
 	out := cmd.OutOrStdout()
 
@@ -54,7 +87,7 @@ func runStatus(cmd *cobra.Command, _ []string) error {
 		return enc.Encode(statuses)
 	}
 
-	tbl := ui.NewTable(out, "REPO", "STATE", "BRANCH", "HEAD", "DIRTY", "LOCK DIFF")
+	tbl := ui.NewTable(out, "REPO", "STATE", "BRANCH", "HEAD", "DIRTY", "UPSTREAM", "STASH", "LOCK DIFF", "DRIFT")
 	for _, s := range statuses {
 		state := "cloned"
 		if !s.Cloned {
@@ -63,49 +96,165 @@ func runStatus(cmd *cobra.Command, _ []string) error {
 		if s.Local {
 			state += " (local)"
 		}
-		tbl.Row(s.ID, state, s.Branch, s.Head, s.Dirty, s.LockDiff)
+		if s.InProgress != "" {
+			state += fmt.Sprintf(" (%s in progress)", s.InProgress)
+		}
+		branch := s.Branch
+		switch {
+		case s.Cloned && !s.RefMatch:
+			branch += fmt.Sprintf(" (%s: %s)", s.RefType, s.Ref)
+		case s.Cloned && s.RefType != manifest.RefBranch:
+			branch = fmt.Sprintf("(%s %s)", s.RefType, s.Ref)
+		}
+		stash := ""
+		if s.Stashes > 0 {
+			stash = fmt.Sprint(s.Stashes)
+		}
+		tbl.Row(s.ID, state, branch, s.Head, dirtyLabel(s), upstreamLabel(s), stash, s.LockDiff, strings.Join(s.Drift, ", "))
 	}
 	return tbl.Flush()
 }
 
+// collectStatuses inspects repos with up to jobs workers and returns the
+// results in manifest order.
+func collectStatuses(ctx *workspace.Context, repos []manifest.Repo, jobs int) []repoStatus {
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	statuses := make([]repoStatus, len(repos))
+	for i, r := range repos {
+		wg.Add(1)
+		go func(i int, r manifest.Repo) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			statuses[i] = collectStatus(ctx, r)
+		}(i, r)
+	}
+	wg.Wait()
+	return statuses
+}
+
 func collectStatus(ctx *workspace.Context, r manifest.Repo) repoStatus {
 	dir := ctx.RepoDir(r)
-	s := repoStatus{ID: r.ID, Local: r.IsLocal()}
+	s := repoStatus{ID: r.ID, Local: r.IsLocal(), Ref: r.Ref}
 
 	if !git.IsCloned(dir) {
 		return s
 	}
 	s.Cloned = true
+	r = withResolvedRef(dir, r, ctx.Lock)
+	s.Ref = r.Ref
 
-	if branch, err := git.CurrentBranch(dir); err == nil {
-		if branch == "" {
+	st, err := git.Status(dir)
+	if err == nil {
+		s.Branch = st.Branch
+		if s.Branch == "" {
 			s.Branch = "(detached)"
-		} else {
-			s.Branch = branch
 		}
+		s.Dirty = st.Dirty()
+		s.Staged, s.Modified, s.Untracked, s.Conflicted = st.Staged, st.Modified, st.Untracked, st.Conflicted
+		s.Upstream, s.Gone, s.Ahead, s.Behind = st.Upstream, st.UpstreamGone, st.Ahead, st.Behind
+		s.RefType = refTypeOrBranch(dir, r)
+		s.RefMatch = onRef(dir, r, s.RefType, st)
+	}
+	if op, err := git.InProgress(dir); err == nil {
+		s.InProgress = op
+	}
+	if n, err := git.StashCount(dir); err == nil {
+		s.Stashes = n
 	}
 	if head, err := git.HeadCommit(dir); err == nil {
 		s.Head = head
 	}
-	if dirty, err := git.IsDirty(dir); err == nil {
-		s.Dirty = dirty
-	}
 
-	if ctx.Lock != nil {
-		if lr, ok := ctx.Lock.Repos[r.ID]; ok {
-			currentFull, _ := git.HeadCommitFull(dir)
-			if currentFull != "" && currentFull != lr.Commit {
-				s.LockDiff = fmt.Sprintf("lock=%s", lr.Commit[:minLen(len(lr.Commit), 7)])
-			}
+	if d := remoteDrift(dir, r); d != "" {
+		s.Drift = append(s.Drift, d)
+	}
+	s.Drift = append(s.Drift, submoduleDrift(dir, r.EffectiveSubmodules(ctx.Manifest.Defaults))...)
+	if drift, err := detectCloneDrift(dir, r, ctx.Manifest.Defaults); err == nil {
+		for _, dr := range drift {
+			s.Drift = append(s.Drift, dr.detail)
 		}
 	}
 
+	if ctx.Lock != nil && st != nil {
+		s.LockDiff = strings.Join(lockDrift(dir, r, ctx.Lock, st), ", ")
+	}
+
 	return s
 }
 
+// submoduleDrift describes submodules whose checkout does not match the
+// superproject. Uninitialized submodules only count when sync is configured
+// to initialize them.
+func submoduleDrift(dir, mode string) []string {
+	subs, err := git.Submodules(dir)
+	if err != nil {
+		return nil
+	}
+	var drift []string
+	for _, sub := range subs {
+		switch {
+		case sub.Conflict:
+			drift = append(drift, fmt.Sprintf("submodule %s: conflict", sub.Path))
+		case !sub.Initialized && mode != manifest.SubmodulesNone:
+			drift = append(drift, fmt.Sprintf("submodule %s: not initialized", sub.Path))
+		case sub.OutOfDate:
+			drift = append(drift, fmt.Sprintf("submodule %s: out of date", sub.Path))
+		}
+	}
+	return drift
+}
+
+// dirtyLabel summarizes uncommitted changes, e.g. "2 modified, 1 untracked".
+func dirtyLabel(s repoStatus) string {
+	if !s.Dirty {
+		return "clean"
+	}
+	var parts []string
+	for _, c := range []struct {
+		n    int
+		kind string
+	}{
+		{s.Staged, "staged"},
+		{s.Modified, "modified"},
+		{s.Untracked, "untracked"},
+		{s.Conflicted, "conflicted"},
+	} {
+		if c.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c.n, c.kind))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// upstreamLabel summarizes how the current branch relates to its upstream,
+// e.g. "behind 3" when sync left it behind origin.
+func upstreamLabel(s repoStatus) string {
+	switch {
+	case s.Upstream == "":
+		return ""
+	case s.Gone:
+		return "gone"
+	case s.Ahead > 0 && s.Behind > 0:
+		return fmt.Sprintf("diverged (+%d/-%d)", s.Ahead, s.Behind)
+	case s.Behind > 0:
+		return fmt.Sprintf("behind %d", s.Behind)
+	case s.Ahead > 0:
+		return fmt.Sprintf("ahead %d", s.Ahead)
+	default:
+		return "up to date"
+	}
+}
+
 func minLen(a, b int) int {
 	if a < b {
 		return a
 	}
 	return b
 }
+
+// shortSHA abbreviates a commit SHA for display.
+func shortSHA(sha string) string {
+	return sha[:minLen(len(sha), 7)]
+}
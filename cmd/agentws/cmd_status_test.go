@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/lock"
 )
 
 func TestRunStatus_table(t *testing.T) {
@@ -97,6 +100,25 @@ func TestRunStatus_dirtyRepo(t *testing.T) {
 	if !statuses[0].Dirty {
 		t.Error("expected dirty: true for repo with uncommitted file")
 	}
+	if statuses[0].Untracked != 1 || statuses[0].Modified != 0 {
+		t.Errorf("expected 1 untracked file, got %+v", statuses[0])
+	}
+}
+
+func TestDirtyLabel(t *testing.T) {
+	tests := []struct {
+		s    repoStatus
+		want string
+	}{
+		{repoStatus{}, "clean"},
+		{repoStatus{Dirty: true, Modified: 2, Untracked: 1}, "2 modified, 1 untracked"},
+		{repoStatus{Dirty: true, Staged: 1, Conflicted: 3}, "1 staged, 3 conflicted"},
+	}
+	for _, tt := range tests {
+		if got := dirtyLabel(tt.s); got != tt.want {
+			t.Errorf("dirtyLabel(%+v) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
 }
 
 func TestRunStatus_unclonedRepo(t *testing.T) {
@@ -184,3 +206,112 @@ func TestRunStatus_lockDiff(t *testing.T) {
 		t.Error("expected non-empty lock_diff when HEAD differs from pinned commit")
 	}
 }
+
+func TestRunStatus_lockCloneStateFollowsVersion(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if err := git.SparseCheckoutSet(dir, []string{"docs"}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	lockPath := filepath.Join(wsDir, "workspace.lock.yaml")
+	lockDiff := func(version int) string {
+		t.Helper()
+		lf, err := lock.Load(lockPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Clone state must not depend on commit_time being recorded.
+		lf.Version = version
+		lf.Repos["backend"].CommitTime = ""
+		if err := lock.Save(lockPath, lf); err != nil {
+			t.Fatal(err)
+		}
+		var statuses []repoStatus
+		out := runAgentws(t, "--root", wsDir, "status", "--json")
+		if err := json.Unmarshal([]byte(out), &statuses); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return statuses[0].LockDiff
+	}
+
+	if got := lockDiff(lock.Version); got != "full checkout" {
+		t.Errorf("v%d lock: lock_diff = %q, want %q", lock.Version, got, "full checkout")
+	}
+	if got := lockDiff(1); got != "" {
+		t.Errorf("v1 lock records no clone state, got lock_diff %q", got)
+	}
+}
+
+func TestRunStatus_filtersAndRefMatch(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	runAgentws(t, "--root", wsDir, "sync")
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if out, err := exec.Command("git", "-C", dir, "checkout", "-b", "feature/x").CombinedOutput(); err != nil {
+		t.Fatalf("checkout: %v\n%s", err, out)
+	}
+
+	var statuses []repoStatus
+	out := runAgentws(t, "--root", wsDir, "status", "--json", "--only", "backend", "--jobs", "2")
+	if err := json.Unmarshal([]byte(out), &statuses); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].ID != "backend" {
+		t.Fatalf("expected only backend, got %+v", statuses)
+	}
+	if statuses[0].RefMatch || statuses[0].Ref != "main" {
+		t.Errorf("feature/x should not match ref main: %+v", statuses[0])
+	}
+
+	out = runAgentws(t, "--root", wsDir, "status", "--json", "--skip", "backend")
+	statuses = nil
+	if err := json.Unmarshal([]byte(out), &statuses); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(statuses) != 1 || !statuses[0].RefMatch {
+		t.Errorf("expected frontend on its manifest ref, got %+v", statuses)
+	}
+}
+
+func TestRunStatus_stashAndInProgress(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync")
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("stashed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "-C", dir, "stash").CombinedOutput(); err != nil {
+		t.Fatalf("stash: %v\n%s", err, out)
+	}
+	// Simulate a stopped merge.
+	head, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".git", "MERGE_HEAD"), head, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runAgentws(t, "--root", wsDir, "status")
+	if !strings.Contains(out, "(merge in progress)") {
+		t.Errorf("expected merge in progress in table, got:\n%s", out)
+	}
+
+	var statuses []repoStatus
+	if err := json.Unmarshal([]byte(runAgentws(t, "--root", wsDir, "status", "--json")), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].Stashes != 1 || statuses[0].InProgress != "merge" {
+		t.Errorf("unexpected status: %+v", statuses[0])
+	}
+}
+
+func TestRunStatus_invalidJobs(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "status", "--jobs", "0"})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error for --jobs 0")
+	}
+}
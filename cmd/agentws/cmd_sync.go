@@ -1,10 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/fbkclanna/agentws/internal/cache"
 	"github.com/fbkclanna/agentws/internal/git"
 	"github.com/fbkclanna/agentws/internal/lock"
 	"github.com/fbkclanna/agentws/internal/manifest"
@@ -27,6 +38,24 @@ func newSyncCmd() *cobra.Command {
 	cmd.Flags().Bool("force", false, "Allow destructive operations")
 	cmd.Flags().Bool("lock", false, "Checkout commits from the lock file")
 	cmd.Flags().Bool("update-lock", false, "Update the lock file after sync")
+	addLockCommitFlags(cmd)
+	cmd.Flags().Bool("prune", false, "Remove repos under repos_root that are no longer in the manifest")
+	cmd.Flags().Bool("yes", false, "Do not ask for confirmation (with --prune)")
+	cmd.Flags().Bool("prune-force", false, "With --prune, also delete dirty repos and repos with unpushed branches")
+	cmd.Flags().Bool("json", false, "Output per-repo results as JSON")
+	cmd.Flags().Duration("timeout", 0, "Timeout for each clone/fetch attempt (e.g. 2m; 0 = no timeout)")
+	cmd.Flags().String("update", "", "Branch update mode after checkout: ff-only, rebase, none (default: defaults.update or ff-only)")
+	cmd.Flags().Int("retries", 0, "Retry failed clone/fetch operations this many times with exponential backoff")
+	cmd.Flags().Bool("no-cache", false, "Do not borrow objects from the shared object cache when cloning")
+	cmd.Flags().Bool("fix-remotes", false, "Point origin of existing clones at the manifest URL (unrelated histories require --allow-unrelated)")
+	cmd.Flags().Bool("allow-unrelated", false, "With --fix-remotes, switch origin even if the new URL shares no history with the clone")
+	cmd.Flags().Duration("max-age", 0, "Skip fetching repos fetched less than this long ago (e.g. 10m; 0 = always check)")
+	cmd.Flags().Bool("always-fetch", false, "Fetch every repo, even if its remote branches are unchanged")
+	cmd.MarkFlagsMutuallyExclusive("max-age", "always-fetch")
+	cmd.Flags().Bool("timings", false, "Print the time spent in each clone, fetch, checkout and post_sync step")
+	cmd.Flags().String("trace-out", "", "Write a Chrome trace (JSON) of the sync workers to this file")
+	addLockSelectFlags(cmd)
+	addOutputFlag(cmd)
 	return cmd
 }
 
@@ -40,6 +69,20 @@ func runSync(cmd *cobra.Command, _ []string) error {
 	force, _ := cmd.Flags().GetBool("force")
 	useLock, _ := cmd.Flags().GetBool("lock")
 	updateLock, _ := cmd.Flags().GetBool("update-lock")
+	prune, _ := cmd.Flags().GetBool("prune")
+	pruneForce, _ := cmd.Flags().GetBool("prune-force")
+	asJSON, _ := cmd.Flags().GetBool("json")
+	yes, _ := cmd.Flags().GetBool("yes")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	retries, _ := cmd.Flags().GetInt("retries")
+	update, _ := cmd.Flags().GetString("update")
+	noCache, _ := cmd.Flags().GetBool("no-cache")
+	fixRemotes, _ := cmd.Flags().GetBool("fix-remotes")
+	allowUnrelated, _ := cmd.Flags().GetBool("allow-unrelated")
+	maxAge, _ := cmd.Flags().GetDuration("max-age")
+	alwaysFetch, _ := cmd.Flags().GetBool("always-fetch")
+	timings, _ := cmd.Flags().GetBool("timings")
+	traceOut, _ := cmd.Flags().GetString("trace-out")
 
 	strategy, err := workspace.ParseStrategy(strategyStr)
 	if err != nil {
@@ -50,6 +93,34 @@ func runSync(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("--jobs must be >= 1 (got %d)", jobs)
 	}
 
+	if err := manifest.ValidateUpdateMode(update); err != nil {
+		return fmt.Errorf("--update: %w", err)
+	}
+
+	if retries < 0 {
+		return fmt.Errorf("--retries must be >= 0 (got %d)", retries)
+	}
+
+	if pruneForce && !prune {
+		return fmt.Errorf("--prune-force requires --prune")
+	}
+
+	if allowUnrelated && !fixRemotes {
+		return fmt.Errorf("--allow-unrelated requires --fix-remotes")
+	}
+
+	if maxAge < 0 {
+		return fmt.Errorf("--max-age must be >= 0 (got %s)", maxAge)
+	}
+
+	ndjson, err := ndjsonOutput(cmd)
+	if err != nil {
+		return err
+	}
+	if ndjson && asJSON {
+		return fmt.Errorf("--json and --output ndjson are mutually exclusive")
+	}
+
 	if strategy == workspace.StrategyReset && !force {
 		return fmt.Errorf("--strategy reset requires --force")
 	}
@@ -58,6 +129,9 @@ func runSync(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
+	if err := selectLock(cmd, ctx); err != nil {
+		return err
+	}
 
 	repos := ctx.Manifest.Repos
 	if profile != "" {
@@ -68,142 +142,988 @@ func runSync(cmd *cobra.Command, _ []string) error {
 	}
 	repos = manifest.FilterByIDs(repos, only, skip)
 
+	if update == "" {
+		update = ctx.Manifest.Defaults.EffectiveUpdate()
+	}
+
+	commitFlag, _ := cmd.Flags().GetBool("commit")
+	pushFlag, _ := cmd.Flags().GetBool("push")
+	if (commitFlag || pushFlag) && !updateLock {
+		return fmt.Errorf("--commit and --push require --update-lock")
+	}
+	lockCommit := lockCommitSettings(cmd, ctx)
+
 	if useLock && ctx.Lock == nil {
-		return fmt.Errorf("--lock specified but no workspace.lock.yaml found")
+		return fmt.Errorf("--lock specified but no %s found", filepath.Base(ctx.LockPath))
 	}
 
-	progress := ui.NewProgress(cmd.ErrOrStderr(), len(repos))
-	if err := runParallelSync(ctx, repos, strategy, useLock, jobs, progress); err != nil {
-		return err
+	// Cancel in-flight git operations on Ctrl-C / SIGTERM.
+	cctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := syncOptions{
+		strategy:       strategy,
+		useLock:        useLock,
+		update:         update,
+		timeout:        timeout,
+		retries:        retries,
+		fixRemotes:     fixRemotes,
+		allowUnrelated: allowUnrelated,
+		maxAge:         maxAge,
+		alwaysFetch:    alwaysFetch,
+	}
+	if !noCache {
+		// The cache is an optimization; without a usable cache directory
+		// clones simply download everything.
+		opts.cache, _ = cache.Default()
+	}
+	progress := newProgress(cmd, ndjson, len(repos))
+	// Hook output goes to stderr alongside progress so stdout stays
+	// reserved for the summary (or JSON).
+	opts.hookOut = progress.Writer(cmd.ErrOrStderr())
+	start := time.Now()
+	results := runParallelSync(cctx, ctx, repos, opts, jobs, progress)
+	wall := time.Since(start)
+
+	if traceOut != "" {
+		if err := writeTrace(traceOut, results, start, jobs); err != nil {
+			return err
+		}
 	}
 
 	out := cmd.OutOrStdout()
+	switch {
+	case ndjson:
+		// The event stream already carries every result; keep stdout
+		// machine-readable and send remaining messages to stderr.
+		out = cmd.ErrOrStderr()
+	case asJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+		// Keep stdout machine-readable; further messages go to stderr.
+		out = cmd.ErrOrStderr()
+	default:
+		if err := printSyncSummary(out, results); err != nil {
+			return err
+		}
+	}
+	if timings {
+		if err := printTimings(out, results, wall, jobs); err != nil {
+			return err
+		}
+	}
+
+	if cctx.Err() != nil {
+		return interruptedError(results)
+	}
+	if err := syncError(results); err != nil {
+		return err
+	}
+
 	if updateLock {
-		if err := writeLock(ctx, repos); err != nil {
+		if err := writeLock(ctx, repos, out); err != nil {
 			return err
 		}
 		_, _ = fmt.Fprintln(out, "Lock file updated.")
+		if lockCommit.commit {
+			if err := commitLock(cctx, ctx, lockCommit, out); err != nil {
+				return err
+			}
+		}
+	}
+
+	if prune {
+		if err := pruneRepos(ctx, out, yes, pruneForce, "--prune-force", false); err != nil {
+			return err
+		}
 	}
 
 	_, _ = fmt.Fprintln(out, "Sync complete.")
 	return nil
 }
 
-func runParallelSync(ctx *workspace.Context, repos []manifest.Repo, strategy workspace.Strategy, useLock bool, jobs int, progress *ui.Progress) error {
-	sem := make(chan struct{}, jobs)
-	var wg sync.WaitGroup
-	errCh := make(chan error, len(repos))
+// Per-repo sync outcomes recorded in syncResult.Action.
+const (
+	syncCloned       = "cloned"
+	syncInitialized  = "initialized"
+	syncFetched      = "fetched"
+	syncFetchSkipped = "fetch-skipped"
+	syncCheckedOut   = "checked-out"
+	syncSkippedDirty = "skipped-dirty"
+	syncFailed       = "failed"
+	syncCancelled    = "cancelled"
+)
+
+// syncOptions holds the per-repo sync settings shared by all workers.
+type syncOptions struct {
+	strategy       workspace.Strategy
+	useLock        bool
+	update         string        // manifest.UpdateFFOnly, UpdateRebase or UpdateNone
+	timeout        time.Duration // per clone/fetch attempt; 0 = none
+	retries        int           // extra attempts for clone/fetch
+	cache          *cache.Cache  // shared object cache to borrow from; nil = disabled
+	fixRemotes     bool          // repoint origin at the manifest URL when they differ
+	allowUnrelated bool          // lets fixRemotes switch to an unrelated history
+	maxAge         time.Duration // skip fetching repos fetched more recently; 0 = off
+	alwaysFetch    bool          // fetch even when ls-remote shows no changes
+	host           *hostClaim    // per repo: its slot of origin's host limit; nil = unlimited
+	skipFetch      string        // per repo: why its fetch can be skipped (see probeRemotes); "" = fetch
+	hookOut        io.Writer     // output of post_sync hooks
+}
+
+// retryBaseDelay is the delay before the first clone/fetch retry; it doubles
+// on each subsequent attempt.
+var retryBaseDelay = time.Second
+
+// rateLimitRetries is how many times a clone/fetch rejected by server
+// throttling is retried, in addition to --retries. The first back-off is
+// rateLimitBaseDelay plus jitter and doubles each time.
+const rateLimitRetries = 4
+
+var rateLimitBaseDelay = 5 * time.Second
+
+// syncResult records the outcome of syncing a single repo.
+type syncResult struct {
+	ID           string        `json:"id"`
+	Action       string        `json:"action"`
+	Ref          string        `json:"ref,omitempty"`
+	RefType      string        `json:"ref_type,omitempty"`
+	Note         string        `json:"note,omitempty"`
+	FetchSkipped string        `json:"fetch_skipped,omitempty"` // why the fetch was skipped
+	Diverged     bool          `json:"diverged,omitempty"`
+	Reconciled   []string      `json:"reconciled,omitempty"`
+	Required     bool          `json:"required"`
+	Error        string        `json:"error,omitempty"`
+	DurationMS   int64         `json:"duration_ms"`
+	Phases       []syncPhase   `json:"phases,omitempty"`
+	duration     time.Duration // for the text summary
+	start        time.Time     // when a worker picked the repo up
+	lane         int           // index of that worker, for --trace-out
+	probe        time.Duration // spent in probeRemotes before a worker picked it up
+	err          error
+}
+
+// hostLimiter caps the number of repos synced at once per remote host, as
+// configured by defaults.host_limits.
+type hostLimiter map[string]chan struct{}
+
+func newHostLimiter(limits map[string]int) hostLimiter {
+	l := make(hostLimiter, len(limits))
+	for host, n := range limits {
+		l[strings.ToLower(host)] = make(chan struct{}, n)
+	}
+	return l
+}
+
+// slot returns the semaphore for the host of url, or nil if the host is not
+// limited.
+func (l hostLimiter) slot(url string) chan struct{} {
+	return l[git.URLHost(url)]
+}
+
+// acquireSlot waits for a slot of a host semaphore, giving up once cctx is
+// cancelled. A nil slot is never busy.
+func acquireSlot(cctx context.Context, slot chan struct{}) error {
+	if slot == nil {
+		return nil
+	}
+	select {
+	case slot <- struct{}{}:
+		return nil
+	case <-cctx.Done():
+		return cctx.Err()
+	}
+}
 
-	for _, r := range repos {
+// withHostSlot runs fn while holding a slot of a host semaphore. A nil slot
+// is never busy.
+func withHostSlot(cctx context.Context, slot chan struct{}, fn func() error) error {
+	if err := acquireSlot(cctx, slot); err != nil {
+		return err
+	}
+	if slot != nil {
+		defer func() { <-slot }()
+	}
+	return fn()
+}
+
+// hostClaim is a repo's slot of its origin's host limit during sync. It is
+// claimed before the repo gets a worker, so repos queued on a busy host leave
+// the workers to other hosts, and released once the repo is done talking to
+// origin, before checkout.
+type hostClaim struct {
+	slot chan struct{}
+	held bool
+}
+
+func (h *hostClaim) claim(cctx context.Context) error {
+	if h == nil || h.held {
+		return nil
+	}
+	if err := acquireSlot(cctx, h.slot); err != nil {
+		return err
+	}
+	h.held = true
+	return nil
+}
+
+func (h *hostClaim) release() {
+	if h == nil || !h.held {
+		return
+	}
+	if h.slot != nil {
+		<-h.slot
+	}
+	h.held = false
+}
+
+// runParallelSync syncs repos with up to jobs workers, and no more than the
+// host limit at once per host talking to origin (see hostClaim). Every repo
+// is attempted regardless of failures elsewhere; results are returned in
+// manifest order. Once cctx is cancelled, repos that have not started are
+// marked cancelled.
+func runParallelSync(cctx context.Context, ctx *workspace.Context, repos []manifest.Repo, opts syncOptions, jobs int, progress *ui.Progress) []syncResult {
+	hosts := newHostLimiter(ctx.Manifest.Defaults.HostLimits)
+	results := make([]syncResult, len(repos))
+	skipFetch := probeRemotes(cctx, ctx, repos, opts, jobs, hosts, results)
+
+	lanes := newLanes(jobs)
+	var wg sync.WaitGroup
+	for i, r := range repos {
 		wg.Add(1)
-		go func(r manifest.Repo) {
+		go func(i int, r manifest.Repo, opts syncOptions) {
 			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
+			res := &results[i]
+			res.ID = r.ID
+			res.Required = r.IsRequired()
+			opts.skipFetch = skipFetch[i]
+
+			// Wait for the host before taking a worker, so repos queued on a
+			// busy host do not hold workers that other hosts could use.
+			opts.host = &hostClaim{slot: hosts.slot(r.URL)}
+			if err := opts.host.claim(cctx); err != nil {
+				res.Action = syncCancelled
+				return
+			}
+			defer opts.host.release()
 
-			if err := syncRepo(ctx, r, strategy, useLock, progress); err != nil {
-				if r.IsRequired() {
-					errCh <- fmt.Errorf("repo %s: %w", r.ID, err)
+			var lane int
+			select {
+			case lane = <-lanes:
+			case <-cctx.Done():
+				res.Action = syncCancelled
+				return
+			}
+			defer func() { lanes <- lane }()
+			if cctx.Err() != nil {
+				res.Action = syncCancelled
+				return
+			}
+
+			res.start, res.lane = time.Now(), lane
+			progress.Start(r.ID)
+			err := syncRepo(cctx, ctx, r, opts, progress, res)
+			res.duration = time.Since(res.start)
+			res.DurationMS = res.duration.Milliseconds()
+			if err != nil {
+				res.Action = syncFailed
+				res.Error = err.Error()
+				res.err = err
+				if cctx.Err() != nil {
+					res.Action = syncCancelled
+					progress.Finish(r.ID, ui.EventFailed, fmt.Sprintf("%s cancelled", r.ID), err)
+				} else if r.IsRequired() {
+					progress.Finish(r.ID, ui.EventFailed, fmt.Sprintf("%s failed: %v", r.ID, err), err)
 				} else {
-					progress.Log("Warning: optional repo %s: %v", r.ID, err)
+					progress.Finish(r.ID, ui.EventFailed, fmt.Sprintf("Warning: optional repo %s: %v", r.ID, err), err)
 				}
 			}
-		}(r)
+		}(i, r, opts)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// newLanes returns a pool of jobs numbered workers, so traces can show which
+// one synced each repo.
+func newLanes(jobs int) chan int {
+	lanes := make(chan int, jobs)
+	for lane := range jobs {
+		lanes <- lane
 	}
+	return lanes
+}
 
+// probeRemotes runs ls-remote for every existing clone up front, up to jobs
+// at a time and within the host limits, and returns why each repo's fetch
+// can be skipped (see fetchSkipReason), indexed like repos. Checking all
+// repos before syncing any keeps the round trips out of the sync workers,
+// where a slow remote would delay every repo queued behind it. Repos whose
+// locked commit is already local, or whose origin --fix-remotes is about to
+// change, are not probed.
+func probeRemotes(cctx context.Context, ctx *workspace.Context, repos []manifest.Repo, opts syncOptions, jobs int, hosts hostLimiter, results []syncResult) []string {
+	reasons := make([]string, len(repos))
+	lanes := newLanes(jobs)
+	var wg sync.WaitGroup
+	for i, r := range repos {
+		dir := ctx.RepoDir(r)
+		if r.IsLocal() || opts.alwaysFetch || !git.IsCloned(dir) {
+			continue
+		}
+		if lr := lockedRepo(ctx, r, opts); lr != nil && git.HasCommit(dir, lr.Commit) {
+			continue
+		}
+		if opts.fixRemotes && remoteDrift(dir, r) != "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, r manifest.Repo, dir string) {
+			defer wg.Done()
+			host := &hostClaim{slot: hosts.slot(r.URL)}
+			if err := host.claim(cctx); err != nil {
+				return
+			}
+			defer host.release()
+			var lane int
+			select {
+			case lane = <-lanes:
+			case <-cctx.Done():
+				return
+			}
+			defer func() { lanes <- lane }()
+
+			res := &results[i]
+			start := time.Now()
+			res.lane = lane
+			reasons[i] = fetchSkipReason(cctx, dir, opts, res)
+			res.probe = time.Since(start)
+		}(i, r, dir)
+	}
 	wg.Wait()
-	close(errCh)
+	return reasons
+}
+
+// syncError joins the errors of all failed required repos.
+func syncError(results []syncResult) error {
+	var errs []error
+	for _, res := range results {
+		if res.err != nil && res.Required {
+			errs = append(errs, fmt.Errorf("repo %s: %w", res.ID, res.err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// interruptedError reports the repos that did not finish before cancellation.
+func interruptedError(results []syncResult) error {
+	var ids []string
+	for _, res := range results {
+		if res.Action == syncCancelled {
+			ids = append(ids, res.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("sync interrupted")
+	}
+	return fmt.Errorf("sync interrupted; %d repo(s) did not finish: %s", len(ids), strings.Join(ids, ", "))
+}
+
+// withRetry runs a network operation, applying opts.timeout to each attempt
+// and retrying up to opts.retries times with exponential backoff. Failures
+// caused by server throttling are additionally retried up to
+// rateLimitRetries times with a longer, jittered backoff. It gives up
+// immediately once cctx is cancelled.
+func withRetry(cctx context.Context, opts syncOptions, progress *ui.Progress, what string, fn func(context.Context) error) error {
+	delay, throttleDelay := retryBaseDelay, rateLimitBaseDelay
+	retries, throttled := 0, 0
+	for {
+		err := withTimeout(cctx, opts.timeout, fn)
+		if err == nil || cctx.Err() != nil {
+			return err
+		}
+		var wait time.Duration
+		switch {
+		case git.IsRateLimited(err) && throttled < rateLimitRetries:
+			throttled++
+			// Jitter keeps workers throttled at the same moment from
+			// retrying in lockstep.
+			wait = throttleDelay + rand.N(throttleDelay/2+1)
+			throttleDelay *= 2
+			progress.Log("%s was rate limited (%v); backing off %s (%d/%d)", what, err, wait.Round(time.Millisecond), throttled, rateLimitRetries)
+		case retries < opts.retries:
+			retries++
+			wait = delay
+			delay *= 2
+			progress.Log("%s failed (%v); retrying in %s (%d/%d)", what, err, wait, retries, opts.retries)
+		default:
+			return err
+		}
+		select {
+		case <-time.After(wait):
+		case <-cctx.Done():
+			return cctx.Err()
+		}
+	}
+}
+
+// withTimeout runs fn with a context limited to timeout (if > 0).
+func withTimeout(cctx context.Context, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout <= 0 {
+		return fn(cctx)
+	}
+	tctx, cancel := context.WithTimeout(cctx, timeout)
+	defer cancel()
+	err := fn(tctx)
+	if err != nil && errors.Is(tctx.Err(), context.DeadlineExceeded) && cctx.Err() == nil {
+		return fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	return err
+}
+
+// printSyncSummary writes a per-repo results table followed by a totals line.
+func printSyncSummary(out io.Writer, results []syncResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	tbl := ui.NewTable(out, "REPO", "RESULT", "REF", "TIME", "ERROR")
+	for _, res := range results {
+		action := res.Action
+		switch {
+		case action == syncFailed && !res.Required:
+			action += " (optional)"
+		case action == syncFetchSkipped:
+			action += " (" + res.FetchSkipped + ")"
+		}
+		note := res.Ref
+		if res.Note != "" {
+			note += " (" + res.Note + ")"
+		}
+		tbl.Row(res.ID, action, note, res.duration.Round(10*time.Millisecond), res.Error)
+		counts[res.Action]++
+	}
+	if err := tbl.Flush(); err != nil {
+		return err
+	}
 
-	for e := range errCh {
-		return e
+	var parts []string
+	for _, a := range []string{syncCloned, syncInitialized, syncFetched, syncFetchSkipped, syncCheckedOut, syncSkippedDirty, syncFailed, syncCancelled} {
+		if counts[a] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[a], a))
+		}
 	}
+	_, _ = fmt.Fprintf(out, "%d repos: %s\n", len(results), strings.Join(parts, ", "))
 	return nil
 }
 
-func syncRepo(ctx *workspace.Context, r manifest.Repo, strategy workspace.Strategy, useLock bool, progress *ui.Progress) error {
+func syncRepo(cctx context.Context, ctx *workspace.Context, r manifest.Repo, opts syncOptions, progress *ui.Progress, res *syncResult) error {
 	dir := ctx.RepoDir(r)
 
-	if err := cloneOrFetch(dir, r, ctx.Manifest.Defaults, progress); err != nil {
-		return err
+	if git.IsCloned(dir) {
+		if err := reconcileRemote(cctx, dir, r, opts, progress, res); err != nil {
+			return err
+		}
+	}
+
+	if lr := lockedRepo(ctx, r, opts); lr != nil && git.IsCloned(dir) && git.HasCommit(dir, lr.Commit) {
+		// Everything needed is already local (e.g. a workspace restored
+		// from a bundle), so no network access is required.
+		res.Action = syncCheckedOut
+	} else if opts.skipFetch != "" {
+		progress.Log("Skipping fetch for %s (%s)", r.ID, opts.skipFetch)
+		res.Action, res.FetchSkipped = syncFetchSkipped, opts.skipFetch
+	} else {
+		phase := phaseFetch
+		if !git.IsCloned(dir) {
+			phase = phaseClone
+		}
+		err := res.timed(phase, func() error {
+			action, err := cloneOrFetch(cctx, dir, r, ctx.Manifest.Defaults, opts, progress)
+			res.Action = action
+			return err
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	skipped, err := handleDirtyForSync(dir, r, strategy, progress)
+	skipped, err := handleDirtyForSync(dir, r, opts.strategy, progress)
 	if err != nil {
 		return err
 	}
 	if skipped {
+		res.Action = syncSkippedDirty
 		return nil
 	}
 
-	// Determine target ref.
-	ref := r.EffectiveRef()
-	if useLock && ctx.Lock != nil {
-		if lr, ok := ctx.Lock.Repos[r.ID]; ok {
-			ref = lr.Commit
+	// Existing clones, including those whose locked commit is already local,
+	// get the clone settings changed in the manifest since they were cloned.
+	if res.Action != syncCloned && res.Action != syncInitialized {
+		if err := reconcileClone(cctx, dir, r, ctx.Manifest.Defaults, opts, progress, res); err != nil {
+			return err
+		}
+	}
+
+	// Determine the target ref, check it out and bring the branch up to date.
+	r = withResolvedRef(dir, r, ctx.Lock)
+	var ref string
+	pending := false
+	err = res.timed(phaseCheckout, func() error {
+		var err error
+		ref, pending, err = checkoutTarget(cctx, ctx, dir, r, opts, progress, res)
+		return err
+	})
+	if err != nil || pending {
+		return err
+	}
+
+	if err := updateSubmodulesAndLFS(cctx, dir, r, ctx.Manifest.Defaults, opts, progress, res); err != nil {
+		return err
+	}
+	if lr := lockedRepo(ctx, r, opts); lr != nil && ctx.Lock.HasCloneState() {
+		if err := restoreLockedState(cctx, dir, r, lr, opts, progress); err != nil {
+			return err
 		}
 	}
 
+	// Run post_sync commands.
+	if err := runPostSync(dir, r.ID, r.PostSync, opts.hookOut, progress, res); err != nil {
+		return err
+	}
+
+	if res.Note != "" {
+		progress.Finish(r.ID, ui.EventDone, fmt.Sprintf("%s synced @ %s (%s)", r.ID, ref, res.Note), nil)
+		return nil
+	}
+	progress.Finish(r.ID, ui.EventDone, fmt.Sprintf("%s synced @ %s", r.ID, ref), nil)
+	return nil
+}
+
+// checkoutTarget checks out the ref r should be on (the locked commit with
+// --lock) and updates the branch from origin. pending is true for a local
+// repo whose branch does not exist yet; nothing is checked out then.
+func checkoutTarget(cctx context.Context, ctx *workspace.Context, dir string, r manifest.Repo, opts syncOptions, progress *ui.Progress, res *syncResult) (ref string, pending bool, err error) {
+	ref = r.EffectiveRef()
+	res.Ref = ref
+	locked := false
+	typ := manifest.RefBranch
+	if lr := lockedRepo(ctx, r, opts); lr != nil {
+		ref = lr.Commit
+		locked = true
+		typ = manifest.RefCommit
+		res.Ref = shortSHA(ref)
+		if !r.IsLocal() {
+			res.Note, err = ensureCommit(cctx, dir, r.ID, lr.Commit, r.EffectiveDepth(ctx.Manifest.Defaults), opts, progress)
+			if err != nil {
+				return "", false, err
+			}
+		}
+		// Stay on the branch that was checked out at pin time if it still
+		// points at the locked commit.
+		if lr.Branch != "" {
+			if head, err := git.ResolveCommit(dir, "refs/heads/"+lr.Branch); err == nil && head == lr.Commit {
+				ref, typ = lr.Branch, manifest.RefBranch
+			}
+		}
+	} else {
+		typ, res.Note, err = prepareRef(cctx, dir, r, ctx.Manifest.Defaults, opts, progress)
+		if err != nil {
+			return "", false, err
+		}
+		res.RefType = typ
+	}
+
 	// For local repos, only checkout if the branch exists.
-	if r.IsLocal() {
+	if r.IsLocal() && typ == manifest.RefBranch {
 		exists, err := git.BranchExists(dir, ref)
 		if err != nil {
-			return fmt.Errorf("checking branch %s: %w", ref, err)
+			return "", false, fmt.Errorf("checking branch %s: %w", ref, err)
 		}
 		if !exists {
-			progress.Done(fmt.Sprintf("%s synced (local, branch %s does not exist yet)", r.ID, ref))
-			return nil
+			res.Note = "branch does not exist yet"
+			progress.Finish(r.ID, ui.EventDone, fmt.Sprintf("%s synced (local, branch %s does not exist yet)", r.ID, ref), nil)
+			return ref, true, nil
 		}
 	}
 
-	if err := git.Checkout(dir, ref); err != nil {
-		return fmt.Errorf("checkout %s: %w", ref, err)
+	// Everything from here on is local or talks to other hosts (submodules,
+	// LFS), so give the host slot to the next repo.
+	opts.host.release()
+	if err := checkoutRef(dir, ref, typ); err != nil {
+		return "", false, fmt.Errorf("checkout %s: %w", ref, err)
 	}
+	progress.Step(r.ID, ui.EventCheckedOut, "")
 
-	// Run post_sync commands.
-	if err := runPostSync(dir, r.PostSync); err != nil {
+	// Bring the local branch up to date with what was just fetched.
+	if !locked && !r.IsLocal() && typ == manifest.RefBranch {
+		note, diverged, err := updateBranch(dir, opts.update)
+		if err != nil {
+			return "", false, err
+		}
+		res.Note = note
+		res.Diverged = diverged
+	}
+	return ref, false, nil
+}
+
+// reconcileClone applies clone settings (sparse, depth, partial_clone) that
+// changed in the manifest after the repo was cloned. Drift that cannot be
+// fixed in place is only reported.
+func reconcileClone(cctx context.Context, dir string, r manifest.Repo, defaults manifest.Defaults, opts syncOptions, progress *ui.Progress, res *syncResult) error {
+	drift, err := detectCloneDrift(dir, r, defaults)
+	if err != nil {
 		return err
 	}
+	for _, dr := range drift {
+		if dr.fix == nil {
+			progress.Log("Warning: %s: %s", r.ID, dr.detail)
+			continue
+		}
+		progress.Log("Reconciling %s: %s", r.ID, dr.detail)
+		if err := withRetry(cctx, opts, progress, "reconcile "+r.ID, dr.fix); err != nil {
+			return fmt.Errorf("reconciling clone settings (%s): %w", dr.detail, err)
+		}
+		res.Reconciled = append(res.Reconciled, dr.detail)
+	}
+	return nil
+}
 
-	progress.Done(fmt.Sprintf("%s synced @ %s", r.ID, ref))
+// reconcileRemote handles an origin URL that no longer matches the manifest.
+// Without --fix-remotes it only warns; with it, origin is repointed after
+// checking that the new URL shares history with the clone (skipped with
+// --allow-unrelated).
+func reconcileRemote(cctx context.Context, dir string, r manifest.Repo, opts syncOptions, progress *ui.Progress, res *syncResult) error {
+	detail := remoteDrift(dir, r)
+	if detail == "" {
+		return nil
+	}
+	if !opts.fixRemotes {
+		progress.Log("Warning: %s: %s; run sync --fix-remotes to update it", r.ID, detail)
+		return nil
+	}
+	if !opts.allowUnrelated {
+		var related bool
+		err := withRetry(cctx, opts, progress, "fetch "+r.URL, func(c context.Context) error {
+			var err error
+			related, err = git.SharesHistory(c, dir, r.URL)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("checking history of %s: %w", r.URL, err)
+		}
+		if !related {
+			return fmt.Errorf("%s has no history in common with the existing clone (use --allow-unrelated to switch origin anyway)", r.URL)
+		}
+	}
+	progress.Log("Updating origin of %s to %s", r.ID, r.URL)
+	if err := git.SetRemoteURL(dir, r.URL); err != nil {
+		return fmt.Errorf("updating origin: %w", err)
+	}
+	res.Reconciled = append(res.Reconciled, detail)
+	return nil
+}
+
+// updateSubmodulesAndLFS brings submodules and LFS files in line with the
+// checked-out commit, according to the repo's submodules and lfs settings.
+func updateSubmodulesAndLFS(cctx context.Context, dir string, r manifest.Repo, defaults manifest.Defaults, opts syncOptions, progress *ui.Progress, res *syncResult) error {
+	if mode := r.EffectiveSubmodules(defaults); mode != manifest.SubmodulesNone {
+		progress.Log("Updating submodules for %s ...", r.ID)
+		err := res.timed(phaseSubmodules, func() error {
+			return withRetry(cctx, opts, progress, "submodule update "+r.ID, func(c context.Context) error {
+				return git.SubmoduleUpdate(c, dir, mode == manifest.SubmodulesShallow)
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("submodule update: %w", err)
+		}
+	}
+	if r.EffectiveLFS(defaults) {
+		if !git.IsLFSInstalled() {
+			return fmt.Errorf("lfs is enabled but git-lfs is not installed")
+		}
+		progress.Log("Pulling LFS objects for %s ...", r.ID)
+		err := res.timed(phaseLFS, func() error {
+			return withRetry(cctx, opts, progress, "lfs pull "+r.ID, func(c context.Context) error {
+				return git.LFSPull(c, dir)
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("lfs pull: %w", err)
+		}
+	}
 	return nil
 }
 
-func cloneOrFetch(dir string, r manifest.Repo, defaults manifest.Defaults, progress *ui.Progress) error {
+// restoreLockedState applies the sparse-checkout and submodule commits
+// recorded in the lock, overriding the manifest settings applied earlier.
+func restoreLockedState(cctx context.Context, dir string, r manifest.Repo, lr *lock.Repo, opts syncOptions, progress *ui.Progress) error {
+	sp, err := git.SparseCheckout(dir)
+	if err != nil {
+		return fmt.Errorf("reading sparse-checkout: %w", err)
+	}
+	switch {
+	case lr.Sparse == nil && sp.Enabled:
+		progress.Log("Restoring full checkout of %s from lock", r.ID)
+		if err := git.SparseCheckoutDisable(dir); err != nil {
+			return fmt.Errorf("disabling sparse-checkout: %w", err)
+		}
+	case lr.Sparse != nil && (!sp.Enabled || sp.Cone != lr.Sparse.Cone || !samePaths(sp.Paths, lr.Sparse.Paths, lr.Sparse.Cone)):
+		progress.Log("Restoring sparse paths of %s from lock", r.ID)
+		if err := git.SparseCheckoutSet(dir, lr.Sparse.Paths, lr.Sparse.Cone); err != nil {
+			return fmt.Errorf("setting sparse-checkout: %w", err)
+		}
+	}
+
+	if len(lr.Submodules) == 0 {
+		return nil
+	}
+	current, err := submoduleCommits(dir)
+	if err != nil {
+		return fmt.Errorf("reading submodules: %w", err)
+	}
+	for _, sub := range lr.Submodules {
+		if _, ok := current[sub.Path]; !ok {
+			progress.Log("Initializing submodules of %s from lock ...", r.ID)
+			err := withRetry(cctx, opts, progress, "submodule update "+r.ID, func(c context.Context) error {
+				return git.SubmoduleUpdate(c, dir, false)
+			})
+			if err != nil {
+				return fmt.Errorf("submodule update: %w", err)
+			}
+			if current, err = submoduleCommits(dir); err != nil {
+				return fmt.Errorf("reading submodules: %w", err)
+			}
+			break
+		}
+	}
+	for _, sub := range lr.Submodules {
+		if current[sub.Path] == sub.Commit {
+			continue
+		}
+		subDir := filepath.Join(dir, filepath.FromSlash(sub.Path))
+		if !git.HasCommit(subDir, sub.Commit) {
+			err := withRetry(cctx, opts, progress, "fetch "+r.ID+"/"+sub.Path, func(c context.Context) error {
+				return git.FetchCommit(c, subDir, sub.Commit, 0)
+			})
+			if err != nil {
+				return fmt.Errorf("fetching submodule %s @ %s: %w", sub.Path, shortSHA(sub.Commit), err)
+			}
+		}
+		if err := git.CheckoutDetached(subDir, sub.Commit); err != nil {
+			return fmt.Errorf("checkout submodule %s @ %s: %w", sub.Path, shortSHA(sub.Commit), err)
+		}
+	}
+	return nil
+}
+
+// submoduleCommits maps the paths of initialized submodules to their
+// checked-out commits.
+func submoduleCommits(dir string) (map[string]string, error) {
+	subs, err := git.Submodules(dir)
+	if err != nil {
+		return nil, err
+	}
+	commits := make(map[string]string, len(subs))
+	for _, sub := range subs {
+		if sub.Initialized {
+			commits[sub.Path] = sub.Commit
+		}
+	}
+	return commits, nil
+}
+
+// lockedRepo returns the lock entry for r when syncing with --lock, or nil.
+func lockedRepo(ctx *workspace.Context, r manifest.Repo, opts syncOptions) *lock.Repo {
+	if !opts.useLock || ctx.Lock == nil {
+		return nil
+	}
+	return ctx.Lock.Repos[r.ID]
+}
+
+// updateBranch moves the checked-out branch to its upstream according to mode.
+// When the branch cannot be fast-forwarded (or rebased cleanly) it is left
+// as is and the divergence is reported via the returned note.
+func updateBranch(dir, mode string) (note string, diverged bool, err error) {
+	if mode == manifest.UpdateNone {
+		return "", false, nil
+	}
+	upstream := git.Upstream(dir)
+	if upstream == "" {
+		return "", false, nil
+	}
+	ahead, behind, err := git.AheadBehind(dir, upstream)
+	if err != nil {
+		return "", false, fmt.Errorf("comparing with %s: %w", upstream, err)
+	}
+
+	switch {
+	case behind == 0 && ahead == 0:
+		return "", false, nil
+	case behind == 0:
+		return fmt.Sprintf("%d ahead of %s", ahead, upstream), false, nil
+	case ahead == 0:
+		if err := git.MergeFFOnly(dir, upstream); err != nil {
+			return "", false, fmt.Errorf("fast-forward to %s: %w", upstream, err)
+		}
+		return fmt.Sprintf("fast-forwarded %d commit(s)", behind), false, nil
+	}
+
+	if mode == manifest.UpdateRebase {
+		if err := git.Rebase(dir, upstream); err == nil {
+			return fmt.Sprintf("rebased %d commit(s) onto %s", ahead, upstream), false, nil
+		}
+	}
+	return fmt.Sprintf("diverged from %s (%d ahead, %d behind)", upstream, ahead, behind), true, nil
+}
+
+// maxDeepenRounds bounds how many times ensureCommit deepens a shallow clone
+// before falling back to a full unshallow.
+const maxDeepenRounds = 4
+
+// ensureCommit makes sure a locked or pinned commit is available in a (possibly shallow
+// or partial) clone. It tries, in order: fetching the exact SHA, deepening the
+// history progressively, and finally unshallowing. It returns a short
+// description of the strategy used, or an empty string if the commit was
+// already present.
+func ensureCommit(cctx context.Context, dir, id, sha string, depth *int, opts syncOptions, progress *ui.Progress) (string, error) {
+	if git.HasCommit(dir, sha) {
+		return "", nil
+	}
+	short := shortSHA(sha)
+	shallow := git.IsShallow(dir)
+
+	fetchDepth := 0
+	if shallow {
+		fetchDepth = 1
+		if depth != nil && *depth > 0 {
+			fetchDepth = *depth
+		}
+	}
+	progress.Log("Fetching commit %s for %s ...", short, id)
+	err := withRetry(cctx, opts, progress, "fetch "+short+" for "+id, func(c context.Context) error {
+		return git.FetchCommit(c, dir, sha, fetchDepth)
+	})
+	if err == nil && git.HasCommit(dir, sha) {
+		return "fetched commit by SHA", nil
+	}
+	if cctx.Err() != nil {
+		return "", cctx.Err()
+	}
+	if !shallow {
+		if err != nil {
+			return "", fmt.Errorf("fetching commit %s: %w", short, err)
+		}
+		return "", fmt.Errorf("commit %s not found on origin", short)
+	}
+	// Servers may refuse to serve a commit by SHA; look for it in a deeper
+	// history instead.
+
+	step := fetchDepth
+	total := 0
+	for range maxDeepenRounds {
+		err := withTimeout(cctx, opts.timeout, func(c context.Context) error {
+			return git.Deepen(c, dir, step)
+		})
+		if err != nil {
+			break
+		}
+		total += step
+		if git.HasCommit(dir, sha) {
+			return fmt.Sprintf("deepened history by %d", total), nil
+		}
+		step *= 2
+	}
+
+	progress.Log("Unshallowing %s to find commit %s ...", id, short)
+	err = withRetry(cctx, opts, progress, "unshallow "+id, func(c context.Context) error {
+		return git.Unshallow(c, dir)
+	})
+	if err != nil {
+		return "", fmt.Errorf("unshallow: %w", err)
+	}
+	if !git.HasCommit(dir, sha) {
+		return "", fmt.Errorf("commit %s not found on origin", short)
+	}
+	return "unshallowed", nil
+}
+
+// fetchSkipReason returns why fetching the existing clone in dir can be
+// skipped, or "" if it has to be fetched: it was fetched within --max-age, or
+// ls-remote shows that origin's branches are unchanged. Errors from ls-remote
+// are not fatal; the regular fetch reports them.
+func fetchSkipReason(cctx context.Context, dir string, opts syncOptions, res *syncResult) string {
+	if opts.maxAge > 0 {
+		if at, ok := git.LastFetch(dir); ok && time.Since(at) < opts.maxAge {
+			return fmt.Sprintf("fetched %s ago", time.Since(at).Round(time.Second))
+		}
+	}
+	var unchanged bool
+	err := res.timed(phaseLsRemote, func() error {
+		return withTimeout(cctx, opts.timeout, func(c context.Context) error {
+			var err error
+			unchanged, err = git.RemoteUnchanged(c, dir)
+			return err
+		})
+	})
+	if err != nil || !unchanged {
+		return ""
+	}
+	return "remote unchanged"
+}
+
+// cloneOrFetch clones (or initializes) a missing repo, or fetches an existing
+// one. It returns the sync action performed. A clone directory created by a
+// failed or cancelled clone is removed so the next attempt starts clean.
+func cloneOrFetch(cctx context.Context, dir string, r manifest.Repo, defaults manifest.Defaults, opts syncOptions, progress *ui.Progress) (string, error) {
 	if !git.IsCloned(dir) {
 		if r.IsLocal() {
-			progress.Log("Initializing %s ...", r.ID)
-			return initLocalRepo(dir)
-		}
-		progress.Log("Cloning %s ...", r.ID)
-		opts := git.CloneOpts{
-			Depth:        r.EffectiveDepth(defaults),
-			PartialClone: r.EffectivePartialClone(defaults),
-			Sparse:       r.Sparse,
+			progress.Step(r.ID, ui.EventCloning, fmt.Sprintf("Initializing %s ...", r.ID))
+			return syncInitialized, initLocalRepo(dir)
 		}
-		return git.Clone(r.URL, dir, opts)
+		progress.Step(r.ID, ui.EventCloning, fmt.Sprintf("Cloning %s ...", r.ID))
+		cloneOpts := cloneOptions(r, defaults)
+		cloneOpts.Reference = opts.cache.Reference(r.URL)
+		_, statErr := os.Stat(dir)
+		existed := statErr == nil
+		err := withRetry(cctx, opts, progress, "clone "+r.ID, func(c context.Context) error {
+			err := git.Clone(c, r.URL, dir, cloneOpts)
+			if err != nil && !existed {
+				_ = os.RemoveAll(dir)
+			}
+			return err
+		})
+		return syncCloned, err
 	}
 	if r.IsLocal() {
 		progress.Log("Skipping fetch for local repo %s", r.ID)
-		return nil
+		return syncCheckedOut, nil
 	}
 	progress.Log("Fetching %s ...", r.ID)
-	if err := git.Fetch(dir); err != nil {
-		return fmt.Errorf("fetch: %w", err)
+	err := withRetry(cctx, opts, progress, "fetch "+r.ID, func(c context.Context) error {
+		return git.Fetch(c, dir)
+	})
+	if err != nil {
+		return "", fmt.Errorf("fetch: %w", err)
 	}
-	return nil
+	progress.Step(r.ID, ui.EventFetched, "")
+	return syncFetched, nil
 }
 
 func handleDirtyForSync(dir string, r manifest.Repo, strategy workspace.Strategy, progress *ui.Progress) (skipped bool, err error) {
-	dirty, err := git.IsDirty(dir)
+	st, err := git.Status(dir)
 	if err != nil {
 		return false, fmt.Errorf("checking dirty state: %w", err)
 	}
-	if !dirty {
+	if !st.Dirty() {
 		return false, nil
 	}
 	switch strategy {
 	case workspace.StrategySafe:
-		progress.Done(fmt.Sprintf("%s skipped (dirty)", r.ID))
+		progress.Finish(r.ID, ui.EventSkipped, fmt.Sprintf("%s skipped (dirty)", r.ID), nil)
 		return true, nil
 	case workspace.StrategyStash:
 		progress.Log("Stashing %s ...", r.ID)
@@ -219,38 +1139,28 @@ func handleDirtyForSync(dir string, r manifest.Repo, strategy workspace.Strategy
 	return false, nil
 }
 
-func runPostSync(repoDir string, commands []manifest.PostSync) error {
+func runPostSync(repoDir, id string, commands []manifest.PostSync, out io.Writer, progress *ui.Progress, res *syncResult) error {
 	for _, ps := range commands {
-		fmt.Printf("  Running post_sync: %s\n", ps.Name)
-		if err := execCmd(repoDir, ps); err != nil {
+		progress.Step(id, ui.EventHookStarted, fmt.Sprintf("  Running post_sync for %s: %s", id, ps.Name))
+		start := time.Now()
+		err := res.timed(phasePostSync+" "+hookLabel(ps), func() error {
+			return execCmd(repoDir, ps, out)
+		})
+		progress.Timed(id, ui.EventHookFinished, ps.Name, time.Since(start), err)
+		if err != nil {
 			return fmt.Errorf("post_sync %q: %w", ps.Name, err)
 		}
 	}
 	return nil
 }
 
-func writeLock(ctx *workspace.Context, repos []manifest.Repo) error {
-	lf := &lock.File{
-		Version:     1,
-		Name:        ctx.Manifest.Name,
-		GeneratedAt: time.Now().Format(time.RFC3339),
-		ToolVersion: version,
-		Repos:       make(map[string]*lock.Repo, len(repos)),
-	}
-	for _, r := range repos {
-		dir := ctx.RepoDir(r)
-		if !git.IsCloned(dir) {
-			continue
-		}
-		commit, err := git.HeadCommitFull(dir)
-		if err != nil {
-			return fmt.Errorf("reading HEAD for %s: %w", r.ID, err)
-		}
-		lf.Repos[r.ID] = &lock.Repo{
-			URL:    r.URL,
-			Ref:    r.EffectiveRef(),
-			Commit: commit,
-		}
+// writeLock merges the current HEAD of the cloned repos into the lock (see
+// buildLock).
+func writeLock(ctx *workspace.Context, repos []manifest.Repo, out io.Writer) error {
+	lf, sum, err := buildLock(ctx, repos, false)
+	if err != nil {
+		return err
 	}
+	printDirtyWarning(out, sum)
 	return lock.Save(ctx.LockPath, lf)
 }
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fbkclanna/agentws/internal/git"
 	"github.com/fbkclanna/agentws/internal/lock"
+	"github.com/fbkclanna/agentws/internal/manifest"
 	"github.com/fbkclanna/agentws/internal/testutil"
+	"github.com/fbkclanna/agentws/internal/ui"
+	"github.com/fbkclanna/agentws/internal/workspace"
 	"gopkg.in/yaml.v3"
 )
 
@@ -531,3 +540,859 @@ func TestRunSync_lockCheckoutVerifyLock(t *testing.T) {
 		t.Error("backend commit should not be empty in lock file")
 	}
 }
+
+func TestRunSync_lockShallowClone(t *testing.T) {
+	wsDir := t.TempDir()
+	bare := testutil.CreateBareRepo(t)
+
+	wsYAML := fmt.Sprintf(`version: 1
+name: test
+repos_root: repos
+defaults:
+  depth: 1
+repos:
+  - id: backend
+    url: file://%s
+    path: repos/backend
+    ref: main
+`, bare)
+	if err := os.WriteFile(filepath.Join(wsDir, "workspace.yaml"), []byte(wsYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync", "--update-lock"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("initial sync failed: %v", err)
+	}
+	dir := filepath.Join(wsDir, "repos", "backend")
+	pinned, err := git.HeadCommitFull(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Move origin ahead and re-clone so the pinned commit is outside the
+	// shallow history.
+	testutil.PushNewCommits(t, bare, 3)
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	root2 := newRootCmd()
+	root2.SetArgs([]string{"--root", wsDir, "sync", "--lock"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("sync --lock on shallow clone failed: %v", err)
+	}
+
+	current, err := git.HeadCommitFull(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != pinned {
+		t.Errorf("expected HEAD=%s (pinned), got %s", pinned[:7], current[:7])
+	}
+}
+
+func TestRunSync_continuesAfterFailures(t *testing.T) {
+	wsDir := t.TempDir()
+	bare := testutil.CreateBareRepo(t)
+	missing := filepath.Join(t.TempDir(), "missing.git")
+
+	wsYAML := fmt.Sprintf(`version: 1
+name: test
+repos_root: repos
+repos:
+  - id: broken-a
+    url: %s
+    path: repos/broken-a
+  - id: backend
+    url: %s
+    path: repos/backend
+    ref: main
+  - id: broken-b
+    url: %s
+    path: repos/broken-b
+`, missing, bare, missing)
+	if err := os.WriteFile(filepath.Join(wsDir, "workspace.yaml"), []byte(wsYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&buf)
+	root.SetArgs([]string{"--root", wsDir, "sync", "--jobs", "1"})
+	err := root.Execute()
+	if err == nil {
+		t.Fatal("expected error when required repos fail")
+	}
+	for _, id := range []string{"broken-a", "broken-b"} {
+		if !strings.Contains(err.Error(), "repo "+id) {
+			t.Errorf("error should mention %s: %v", id, err)
+		}
+	}
+	if !git.IsCloned(filepath.Join(wsDir, "repos", "backend")) {
+		t.Error("backend should be cloned despite other failures")
+	}
+	if !strings.Contains(buf.String(), "1 cloned, 2 failed") {
+		t.Errorf("summary missing totals: %s", buf.String())
+	}
+}
+
+func TestRunSync_json(t *testing.T) {
+	wsDir := t.TempDir()
+	bare := testutil.CreateBareRepo(t)
+	missing := filepath.Join(t.TempDir(), "missing.git")
+
+	wsYAML := fmt.Sprintf(`version: 1
+name: test
+repos_root: repos
+repos:
+  - id: backend
+    url: %s
+    path: repos/backend
+    ref: main
+  - id: extras
+    url: %s
+    path: repos/extras
+    required: false
+`, bare, missing)
+	if err := os.WriteFile(filepath.Join(wsDir, "workspace.yaml"), []byte(wsYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&buf)
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync", "--json"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync --json should succeed when only optional repos fail: %v", err)
+	}
+
+	var results []syncResult
+	if err := json.Unmarshal(buf.Bytes(), &results); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, buf.String())
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].ID != "backend" || results[0].Action != syncCloned || results[0].Ref != "main" {
+		t.Errorf("unexpected backend result: %+v", results[0])
+	}
+	if results[1].ID != "extras" || results[1].Action != syncFailed || results[1].Required || results[1].Error == "" {
+		t.Errorf("unexpected extras result: %+v", results[1])
+	}
+
+	// A second sync fetches the existing clone and skips dirty repos.
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if err := os.WriteFile(filepath.Join(dir, "dirty.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	root2 := newRootCmd()
+	root2.SetOut(&buf)
+	root2.SetErr(&bytes.Buffer{})
+	root2.SetArgs([]string{"--root", wsDir, "sync", "--json", "--only", "backend"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("second sync failed: %v", err)
+	}
+	results = nil
+	if err := json.Unmarshal(buf.Bytes(), &results); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if len(results) != 1 || results[0].Action != syncSkippedDirty {
+		t.Errorf("expected skipped-dirty result, got %+v", results)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	orig := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = orig }()
+
+	progress := ui.NewProgress(&bytes.Buffer{}, 1)
+
+	calls := 0
+	flaky := func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+	if err := withRetry(context.Background(), syncOptions{retries: 2}, progress, "fetch", flaky); err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+
+	calls = 0
+	if err := withRetry(context.Background(), syncOptions{retries: 1}, progress, "fetch", flaky); err == nil {
+		t.Fatal("expected failure when retries are exhausted")
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+}
+
+func TestWithRetry_rateLimited(t *testing.T) {
+	orig := rateLimitBaseDelay
+	rateLimitBaseDelay = time.Millisecond
+	defer func() { rateLimitBaseDelay = orig }()
+
+	var log bytes.Buffer
+	progress := ui.NewProgress(&log, 1)
+
+	calls := 0
+	throttled := func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("git fetch: exit status 128: remote: API rate limit exceeded")
+		}
+		return nil
+	}
+	// Throttling is retried even without --retries.
+	if err := withRetry(context.Background(), syncOptions{}, progress, "fetch", throttled); err != nil {
+		t.Fatalf("expected success after backing off, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+	if !strings.Contains(log.String(), "rate limited") {
+		t.Errorf("expected back-off message, got %q", log.String())
+	}
+
+	calls = 0
+	always := func(context.Context) error {
+		calls++
+		return errors.New("kex_exchange_identification: Connection closed by remote host")
+	}
+	if err := withRetry(context.Background(), syncOptions{}, progress, "fetch", always); err == nil {
+		t.Fatal("expected failure once back-off attempts are exhausted")
+	}
+	if calls != 1+rateLimitRetries {
+		t.Errorf("expected %d attempts, got %d", 1+rateLimitRetries, calls)
+	}
+}
+
+// cloneCounter is a git runner that fails every command and records the peak
+// number of concurrent clones per host and in total.
+type cloneCounter struct {
+	mu        sync.Mutex
+	cur       map[string]int
+	peak      map[string]int
+	total     int
+	totalPeak int
+}
+
+func (c *cloneCounter) Run(_ context.Context, cmd git.Cmd) error {
+	if len(cmd.Args) == 0 || cmd.Args[0] != "clone" {
+		return errors.New("unexpected git call")
+	}
+	host := git.URLHost(cmd.Args[len(cmd.Args)-2])
+	c.mu.Lock()
+	c.cur[host]++
+	c.peak[host] = max(c.peak[host], c.cur[host])
+	c.total++
+	c.totalPeak = max(c.totalPeak, c.total)
+	c.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	c.mu.Lock()
+	c.cur[host]--
+	c.total--
+	c.mu.Unlock()
+	return errors.New("clone failed")
+}
+
+func TestRunParallelSync_hostLimits(t *testing.T) {
+	ws := &manifest.Workspace{
+		Version:   1,
+		Name:      "test",
+		ReposRoot: "repos",
+		Defaults:  manifest.Defaults{HostLimits: map[string]int{"GitHub.com": 2}},
+	}
+	for i := range 6 {
+		url := fmt.Sprintf("git@github.com:org/r%d.git", i)
+		if i >= 4 {
+			url = fmt.Sprintf("https://gitlab.example.com/org/r%d.git", i)
+		}
+		ws.Repos = append(ws.Repos, manifest.Repo{ID: fmt.Sprintf("r%d", i), URL: url, Path: fmt.Sprintf("repos/r%d", i)})
+	}
+	ctx := &workspace.Context{Root: t.TempDir(), Manifest: ws}
+
+	counter := &cloneCounter{cur: map[string]int{}, peak: map[string]int{}}
+	defer git.SetRunner(git.SetRunner(counter))
+
+	progress := ui.NewProgress(&bytes.Buffer{}, len(ws.Repos))
+	runParallelSync(context.Background(), ctx, ws.Repos, syncOptions{strategy: workspace.StrategySafe}, 6, progress)
+
+	if got := counter.peak["github.com"]; got != 2 {
+		t.Errorf("peak concurrent github.com clones = %d, want 2", got)
+	}
+	if got := counter.peak["gitlab.example.com"]; got != 2 {
+		t.Errorf("peak concurrent gitlab.example.com clones = %d, want 2 (unlimited)", got)
+	}
+}
+
+func TestRunParallelSync_queuedHostLeavesWorkersFree(t *testing.T) {
+	// Repos of the limited host come first; while they queue for it, the
+	// other workers must go to the repos of the unlimited host.
+	ws := &manifest.Workspace{
+		Version:   1,
+		Name:      "test",
+		ReposRoot: "repos",
+		Defaults:  manifest.Defaults{HostLimits: map[string]int{"github.com": 1}},
+	}
+	for i := range 8 {
+		url := fmt.Sprintf("git@github.com:org/r%d.git", i)
+		if i >= 5 {
+			url = fmt.Sprintf("https://gitlab.example.com/org/r%d.git", i)
+		}
+		ws.Repos = append(ws.Repos, manifest.Repo{ID: fmt.Sprintf("r%d", i), URL: url, Path: fmt.Sprintf("repos/r%d", i)})
+	}
+	ctx := &workspace.Context{Root: t.TempDir(), Manifest: ws}
+
+	counter := &cloneCounter{cur: map[string]int{}, peak: map[string]int{}}
+	defer git.SetRunner(git.SetRunner(counter))
+
+	progress := ui.NewProgress(&bytes.Buffer{}, len(ws.Repos))
+	runParallelSync(context.Background(), ctx, ws.Repos, syncOptions{strategy: workspace.StrategySafe}, 4, progress)
+
+	if got := counter.peak["github.com"]; got != 1 {
+		t.Errorf("peak concurrent github.com clones = %d, want 1", got)
+	}
+	if got := counter.totalPeak; got != 4 {
+		t.Errorf("peak busy workers = %d, want all 4 (1 github.com + 3 gitlab.example.com)", got)
+	}
+}
+
+func TestEnsureCommit_reportsFetchError(t *testing.T) {
+	orig := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = orig }()
+
+	sha := strings.Repeat("a", 40)
+	fake := &git.FakeRunner{}
+	fake.On("cat-file -e", "", git.ExitStatus(1))
+	fake.On("rev-parse --is-shallow-repository", "false\n", nil)
+	fake.On("fetch --no-write-fetch-head origin "+sha, "", errors.New("fatal: unable to access origin: Could not resolve host"))
+	defer git.SetRunner(git.SetRunner(fake))
+
+	progress := ui.NewProgress(&bytes.Buffer{}, 1)
+	_, err := ensureCommit(context.Background(), t.TempDir(), "backend", sha, nil, syncOptions{retries: 1}, progress)
+	if err == nil || !strings.Contains(err.Error(), "fetching commit aaaaaaa") || !strings.Contains(err.Error(), "Could not resolve host") {
+		t.Fatalf("expected the fetch error, got %v", err)
+	}
+	fetches := 0
+	for _, c := range fake.Calls() {
+		if strings.Contains(c, "fetch --no-write-fetch-head origin "+sha) {
+			fetches++
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("fetch attempts = %d, want 2 (--retries 1)", fetches)
+	}
+
+	// A fetch that succeeds without bringing in the commit means it does
+	// not exist on origin.
+	fake.On("fetch --no-write-fetch-head origin "+sha, "", nil)
+	if _, err := ensureCommit(context.Background(), t.TempDir(), "backend", sha, nil, syncOptions{}, progress); err == nil || !strings.Contains(err.Error(), "not found on origin") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	err := withTimeout(context.Background(), 10*time.Millisecond, func(c context.Context) error {
+		<-c.Done()
+		return c.Err()
+	})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 10ms") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
+
+func TestRunParallelSync_cancelled(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	ctx, err := workspace.Load(wsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	progress := ui.NewProgress(&bytes.Buffer{}, len(ctx.Manifest.Repos))
+	results := runParallelSync(cctx, ctx, ctx.Manifest.Repos, syncOptions{strategy: workspace.StrategySafe}, 1, progress)
+	for _, res := range results {
+		if res.Action != syncCancelled {
+			t.Errorf("repo %s: action = %q, want %q", res.ID, res.Action, syncCancelled)
+		}
+		if git.IsCloned(filepath.Join(wsDir, "repos", res.ID)) {
+			t.Errorf("repo %s should not be cloned after cancellation", res.ID)
+		}
+	}
+
+	err = interruptedError(results)
+	if !strings.Contains(err.Error(), "2 repo(s) did not finish: backend, frontend") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCloneOrFetch_cleansUpFailedClone(t *testing.T) {
+	wsDir := t.TempDir()
+	dir := filepath.Join(wsDir, "repos", "broken")
+	r := manifest.Repo{ID: "broken", URL: filepath.Join(t.TempDir(), "missing.git"), Path: "repos/broken"}
+
+	progress := ui.NewProgress(&bytes.Buffer{}, 1)
+	if _, err := cloneOrFetch(context.Background(), dir, r, manifest.Defaults{}, syncOptions{}, progress); err == nil {
+		t.Fatal("expected clone error")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("partial clone directory should be removed, stat err = %v", err)
+	}
+}
+
+func TestRunSync_fastForwardsBranch(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("initial sync failed: %v", err)
+	}
+
+	testutil.PushNewCommit(t, bareRepos[0])
+
+	root2 := newRootCmd()
+	root2.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("re-sync failed: %v", err)
+	}
+
+	dir := filepath.Join(wsDir, "repos", "backend")
+	ahead, behind, err := git.AheadBehind(dir, "origin/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ahead != 0 || behind != 0 {
+		t.Errorf("expected main to match origin/main, got ahead=%d behind=%d", ahead, behind)
+	}
+}
+
+func TestRunSync_updateNoneLeavesBranchBehind(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("initial sync failed: %v", err)
+	}
+
+	testutil.PushNewCommit(t, bareRepos[0])
+
+	root2 := newRootCmd()
+	root2.SetArgs([]string{"--root", wsDir, "sync", "--update", "none"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("sync --update none failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	root3 := newRootCmd()
+	root3.SetOut(&buf)
+	root3.SetArgs([]string{"--root", wsDir, "status", "--json"})
+	if err := root3.Execute(); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	var statuses []repoStatus
+	if err := json.Unmarshal(buf.Bytes(), &statuses); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if statuses[0].Upstream != "origin/main" || statuses[0].Behind != 1 {
+		t.Errorf("expected status to report 1 behind origin/main, got %+v", statuses[0])
+	}
+}
+
+func TestRunSync_divergedBranchIsReported(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("initial sync failed: %v", err)
+	}
+
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if err := os.WriteFile(filepath.Join(dir, "local.txt"), []byte("local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Add(dir, "local.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Commit(dir, "local commit"); err != nil {
+		t.Fatal(err)
+	}
+	localHead, _ := git.HeadCommitFull(dir)
+	testutil.PushNewCommit(t, bareRepos[0])
+
+	var buf bytes.Buffer
+	root2 := newRootCmd()
+	root2.SetOut(&buf)
+	root2.SetErr(&bytes.Buffer{})
+	root2.SetArgs([]string{"--root", wsDir, "sync", "--json"})
+	if err := root2.Execute(); err != nil {
+		t.Fatalf("sync should not fail on divergence: %v", err)
+	}
+	var results []syncResult
+	if err := json.Unmarshal(buf.Bytes(), &results); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !results[0].Diverged || !strings.Contains(results[0].Note, "1 ahead, 1 behind") {
+		t.Errorf("expected divergence to be reported, got %+v", results[0])
+	}
+	if head, _ := git.HeadCommitFull(dir); head != localHead {
+		t.Error("diverged branch should be left unchanged")
+	}
+
+	// Rebase mode replays the local commit on top of origin.
+	root3 := newRootCmd()
+	root3.SetOut(&bytes.Buffer{})
+	root3.SetArgs([]string{"--root", wsDir, "sync", "--update", "rebase"})
+	if err := root3.Execute(); err != nil {
+		t.Fatalf("sync --update rebase failed: %v", err)
+	}
+	ahead, behind, err := git.AheadBehind(dir, "origin/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ahead != 1 || behind != 0 {
+		t.Errorf("expected 1 ahead, 0 behind after rebase, got ahead=%d behind=%d", ahead, behind)
+	}
+}
+
+func TestRunSync_invalidUpdateMode(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync", "--update", "merge"})
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected error for unknown --update mode")
+	}
+}
+
+func TestRunSync_ndjsonOutput(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+
+	var stdout, stderr bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--root", wsDir, "sync", "--output", "ndjson"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync --output ndjson failed: %v", err)
+	}
+
+	seen := make(map[string]map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		var e ui.Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("stdout line is not a JSON event: %v: %q", err, line)
+		}
+		if seen[e.Repo] == nil {
+			seen[e.Repo] = make(map[string]bool)
+		}
+		seen[e.Repo][e.Type] = true
+	}
+	for _, id := range []string{"backend", "frontend"} {
+		for _, typ := range []string{ui.EventRepoStarted, ui.EventCloning, ui.EventCheckedOut, ui.EventDone} {
+			if !seen[id][typ] {
+				t.Errorf("missing %s event for %s", typ, id)
+			}
+		}
+	}
+	if !strings.Contains(stderr.String(), "Sync complete.") {
+		t.Errorf("trailing messages should go to stderr: %q", stderr.String())
+	}
+}
+
+func TestRunSync_outputInvalid(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+
+	root := newRootCmd()
+	root.SetArgs([]string{"--root", wsDir, "sync", "--output", "xml"})
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected error for unknown --output format")
+	}
+
+	root2 := newRootCmd()
+	root2.SetArgs([]string{"--root", wsDir, "sync", "--output", "ndjson", "--json"})
+	if err := root2.Execute(); err == nil {
+		t.Fatal("expected error for --output ndjson with --json")
+	}
+}
+
+func TestRunSync_submodules(t *testing.T) {
+	sub := testutil.CreateBareRepo(t)
+	bare := testutil.CreateBareRepoWithSubmodule(t, sub, "lib/sub")
+	wsDir := t.TempDir()
+	wsYAML := fmt.Sprintf(`version: 1
+name: test
+repos_root: repos
+repos:
+  - id: backend
+    url: %s
+    path: repos/backend
+    ref: main
+    submodules: recursive
+`, bare)
+	if err := os.WriteFile(filepath.Join(wsDir, "workspace.yaml"), []byte(wsYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(wsDir, "repos", "backend", "lib", "sub", "README.md")); err != nil {
+		t.Errorf("submodule should be checked out after sync: %v", err)
+	}
+
+	var buf bytes.Buffer
+	status := newRootCmd()
+	status.SetOut(&buf)
+	status.SetArgs([]string{"--root", wsDir, "status", "--json"})
+	if err := status.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "drift") {
+		t.Errorf("no drift expected after sync: %s", buf.String())
+	}
+
+	// Deinitializing the submodule is reported as drift.
+	if err := os.RemoveAll(filepath.Join(wsDir, "repos", "backend", "lib", "sub")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(wsDir, "repos", "backend", "lib", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	status2 := newRootCmd()
+	status2.SetOut(&buf)
+	status2.SetArgs([]string{"--root", wsDir, "status", "--json"})
+	if err := status2.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "submodule lib/sub: not initialized") {
+		t.Errorf("expected submodule drift in status: %s", buf.String())
+	}
+}
+
+func TestRunSync_lockRestoresSubmoduleCommit(t *testing.T) {
+	sub := testutil.CreateBareRepo(t)
+	bare := testutil.CreateBareRepoWithSubmodule(t, sub, "lib/sub")
+	wsDir := t.TempDir()
+	wsYAML := fmt.Sprintf(`version: 1
+name: test
+repos_root: repos
+repos:
+  - id: backend
+    url: %s
+    path: repos/backend
+    ref: main
+    submodules: recursive
+`, bare)
+	if err := os.WriteFile(filepath.Join(wsDir, "workspace.yaml"), []byte(wsYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runAgentws(t, "--root", wsDir, "sync")
+
+	// Move the submodule past the commit recorded in the superproject and
+	// pin that state.
+	testutil.PushNewCommit(t, sub)
+	subDir := filepath.Join(wsDir, "repos", "backend", "lib", "sub")
+	if err := git.Fetch(context.Background(), subDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.CheckoutDetached(subDir, "origin/main"); err != nil {
+		t.Fatal(err)
+	}
+	pinned, err := git.HeadCommitFull(subDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runAgentws(t, "--root", wsDir, "pin")
+
+	// Go back to the submodule commit recorded in the superproject.
+	if err := git.SubmoduleUpdate(context.Background(), filepath.Join(wsDir, "repos", "backend"), false); err != nil {
+		t.Fatal(err)
+	}
+	if out := runAgentws(t, "--root", wsDir, "status", "--json"); !strings.Contains(out, "submodule lib/sub="+shortSHA(pinned)) {
+		t.Errorf("status should report submodule drift from the lock: %s", out)
+	}
+
+	runAgentws(t, "--root", wsDir, "sync", "--lock")
+	if head, _ := git.HeadCommitFull(subDir); head != pinned {
+		t.Errorf("submodule HEAD = %s, want locked %s", head, pinned)
+	}
+}
+
+func TestRunSync_lfsRequiresGitLFS(t *testing.T) {
+	if git.IsLFSInstalled() {
+		t.Skip("git-lfs is installed")
+	}
+	wsDir, _ := setupWorkspace(t, 1)
+	path := filepath.Join(wsDir, "workspace.yaml")
+	ws, err := manifest.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.Defaults.LFS = true
+	if err := manifest.Save(path, ws); err != nil {
+		t.Fatal(err)
+	}
+
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync"})
+	err = root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "git-lfs is not installed") {
+		t.Fatalf("expected git-lfs error, got %v", err)
+	}
+}
+
+func TestRunSync_skipsUnchangedFetch(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 2)
+	runAgentws(t, "--root", wsDir, "sync")
+	testutil.PushNewCommit(t, bareRepos[0])
+
+	out := runAgentws(t, "--root", wsDir, "sync", "--json")
+	var results []syncResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if results[0].Action != syncFetched {
+		t.Errorf("backend: action = %q, want %q", results[0].Action, syncFetched)
+	}
+	if results[1].Action != syncFetchSkipped || results[1].FetchSkipped != "remote unchanged" {
+		t.Errorf("frontend: action = %q (%q), want fetch skipped as unchanged", results[1].Action, results[1].FetchSkipped)
+	}
+
+	out = runAgentws(t, "--root", wsDir, "sync", "--always-fetch")
+	if !strings.Contains(out, "2 fetched") {
+		t.Errorf("--always-fetch should fetch every repo:\n%s", out)
+	}
+}
+
+// callRecorder is a git runner that records the subcommand of every call
+// before running it.
+type callRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (c *callRecorder) Run(ctx context.Context, cmd git.Cmd) error {
+	c.mu.Lock()
+	c.calls = append(c.calls, cmd.Args[0])
+	c.mu.Unlock()
+	return git.ExecRunner{}.Run(ctx, cmd)
+}
+
+func TestRunSync_lsRemoteBeforeSync(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 3)
+	runAgentws(t, "--root", wsDir, "sync")
+	testutil.PushNewCommit(t, bareRepos[0])
+
+	rec := &callRecorder{}
+	defer git.SetRunner(git.SetRunner(rec))
+	out := runAgentws(t, "--root", wsDir, "sync", "--jobs", "3")
+	if !strings.Contains(out, "1 fetched") || !strings.Contains(out, "2 fetch-skipped") {
+		t.Errorf("unexpected summary:\n%s", out)
+	}
+
+	lsRemotes, lastLsRemote, firstFetch := 0, -1, -1
+	for i, c := range rec.calls {
+		switch c {
+		case "ls-remote":
+			lsRemotes++
+			lastLsRemote = i
+		case "fetch":
+			if firstFetch < 0 {
+				firstFetch = i
+			}
+		}
+	}
+	if lsRemotes != 3 {
+		t.Errorf("ls-remote calls = %d, want 3", lsRemotes)
+	}
+	if firstFetch < lastLsRemote {
+		t.Errorf("every ls-remote should run before the first fetch: %v", rec.calls)
+	}
+}
+
+func TestRunSync_maxAge(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync", "--always-fetch")
+	runAgentws(t, "--root", wsDir, "sync", "--always-fetch") // writes FETCH_HEAD
+	testutil.PushNewCommit(t, bareRepos[0])
+
+	out := runAgentws(t, "--root", wsDir, "sync", "--max-age", "1h")
+	if !strings.Contains(out, "fetch-skipped (fetched") || !strings.Contains(out, "1 fetch-skipped") {
+		t.Errorf("expected fetch skipped by --max-age:\n%s", out)
+	}
+
+	out = runAgentws(t, "--root", wsDir, "sync")
+	if !strings.Contains(out, "1 fetched") {
+		t.Errorf("expected fetch without --max-age:\n%s", out)
+	}
+}
+
+func TestRunSync_updateLockCommit(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	if err := git.Init(wsDir); err != nil {
+		t.Fatal(err)
+	}
+
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync", "--commit"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "require --update-lock") {
+		t.Fatalf("expected --update-lock error, got %v", err)
+	}
+
+	out := runAgentws(t, "--root", wsDir, "sync", "--update-lock", "--commit")
+	if !strings.Contains(out, "Committed workspace.lock.yaml (1 repo(s) changed)") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if _, ok, err := git.FileAt(wsDir, "HEAD", "workspace.lock.yaml"); err != nil || !ok {
+		t.Errorf("lock should be committed (ok=%v, err=%v)", ok, err)
+	}
+}
+
+func TestSync_postSyncOutputGoesToErr(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		for i := range ws.Repos {
+			ws.Repos[i].PostSync = []manifest.PostSync{{Name: "echo", Cmd: []string{"sh", "-c", "echo hook-out; echo hook-err >&2"}}}
+		}
+	})
+
+	var stdout, stderr bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--root", wsDir, "sync", "--jobs", "2"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"hook-out", "hook-err"} {
+		if n := strings.Count(stderr.String(), want); n != 2 {
+			t.Errorf("%q appears %d times in the command's stderr, want 2:\n%s", want, n, stderr.String())
+		}
+		if strings.Contains(stdout.String(), want) {
+			t.Errorf("hook output %q leaked into stdout:\n%s", want, stdout.String())
+		}
+	}
+}
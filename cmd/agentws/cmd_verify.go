@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/ui"
+	"github.com/fbkclanna/agentws/internal/workspace"
+	"github.com/spf13/cobra"
+)
+
+// Verify failure classes. Each class has its own exit code bit, so the exit
+// status of a failed verify is the sum of the codes of all classes found.
+const (
+	verifyMissing   = "missing"
+	verifyDirty     = "dirty"
+	verifyCommit    = "commit"
+	verifyOrigin    = "origin"
+	verifyUnmanaged = "unmanaged"
+	verifyError     = "error"
+)
+
+var verifyExitCodes = map[string]int{
+	verifyMissing:   2,
+	verifyDirty:     4,
+	verifyCommit:    8,
+	verifyOrigin:    16,
+	verifyUnmanaged: 32,
+	verifyError:     64,
+}
+
+// verifyClasses lists the failure classes in exit code order.
+var verifyClasses = []string{verifyMissing, verifyDirty, verifyCommit, verifyOrigin, verifyUnmanaged, verifyError}
+
+func newVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check that the workspace exactly matches the lock (for CI)",
+		Long: `Check that every repo is cloned, clean, at its locked commit and pointing at
+the expected origin URL, and that repos_root holds no unmanaged repos.
+
+Exit codes (added together when several classes fail):
+  2  missing    repo not cloned
+  4  dirty      uncommitted changes
+  8  commit     HEAD differs from the lock, repo not in the lock, or lock
+                entry not in the manifest
+  16 origin     origin URL differs from the lock/manifest
+  32 unmanaged  extra repos under repos_root
+  64 error      repo state could not be read`,
+		RunE: runVerify,
+	}
+	cmd.Flags().Bool("json", false, "Output results as JSON")
+	cmd.Flags().String("junit", "", "Also write a JUnit XML report to this file")
+	addLockSelectFlags(cmd)
+	return cmd
+}
+
+// verifyFailure is a single failed check.
+type verifyFailure struct {
+	Class   string `json:"class"`
+	Message string `json:"message"`
+}
+
+// verifyRepo holds the failed checks of one repo (or unmanaged directory).
+type verifyRepo struct {
+	ID       string          `json:"id"`
+	Path     string          `json:"path"`
+	Skipped  string          `json:"skipped,omitempty"`
+	Failures []verifyFailure `json:"failures,omitempty"`
+}
+
+type verifyReport struct {
+	OK       bool         `json:"ok"`
+	ExitCode int          `json:"exit_code"`
+	Lock     string       `json:"lock"`
+	Repos    []verifyRepo `json:"repos"`
+}
+
+func runVerify(cmd *cobra.Command, _ []string) error {
+	root, _ := cmd.Flags().GetString("root")
+	asJSON, _ := cmd.Flags().GetBool("json")
+	junitPath, _ := cmd.Flags().GetString("junit")
+
+	ctx, err := workspace.Load(root)
+	if err != nil {
+		return err
+	}
+	if err := selectLock(cmd, ctx); err != nil {
+		return err
+	}
+	if ctx.Lock == nil {
+		return fmt.Errorf("no %s found; run agentws pin or sync --update-lock first", filepath.Base(ctx.LockPath))
+	}
+	// From here on a non-zero exit means verification failed, not misuse.
+	cmd.SilenceUsage = true
+
+	report, err := verifyWorkspace(ctx)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(ctx.Root, ctx.LockPath); err == nil {
+		report.Lock = filepath.ToSlash(rel)
+	}
+
+	if junitPath != "" {
+		if err := writeVerifyJUnit(junitPath, report); err != nil {
+			return err
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		if err := printVerifyReport(out, report); err != nil {
+			return err
+		}
+	}
+
+	if report.OK {
+		return nil
+	}
+	return &exitError{code: report.ExitCode, err: fmt.Errorf("verify failed: %s", strings.Join(failedClasses(report), ", "))}
+}
+
+// verifyWorkspace checks every manifest repo against the lock, flags lock
+// entries without a manifest repo and looks for unmanaged repos under
+// repos_root.
+func verifyWorkspace(ctx *workspace.Context) (verifyReport, error) {
+	report := verifyReport{}
+	inManifest := make(map[string]bool, len(ctx.Manifest.Repos))
+	for _, r := range ctx.Manifest.Repos {
+		inManifest[r.ID] = true
+		report.Repos = append(report.Repos, verifyManifestRepo(ctx, r))
+	}
+	for _, id := range sortedLockIDs(ctx.Lock) {
+		if inManifest[id] {
+			continue
+		}
+		report.Repos = append(report.Repos, verifyRepo{
+			ID:       id,
+			Failures: []verifyFailure{{Class: verifyCommit, Message: "in the lock but not in the manifest"}},
+		})
+	}
+
+	unmanaged, err := ctx.FindUnmanagedRepos()
+	if err != nil {
+		return report, err
+	}
+	for _, dir := range unmanaged {
+		rel, err := filepath.Rel(ctx.Root, dir)
+		if err != nil {
+			rel = dir
+		}
+		rel = filepath.ToSlash(rel)
+		report.Repos = append(report.Repos, verifyRepo{
+			ID:       rel,
+			Path:     rel,
+			Failures: []verifyFailure{{Class: verifyUnmanaged, Message: "not in the manifest"}},
+		})
+	}
+
+	for _, class := range failedClasses(report) {
+		report.ExitCode += verifyExitCodes[class]
+	}
+	report.OK = report.ExitCode == 0
+	return report, nil
+}
+
+func verifyManifestRepo(ctx *workspace.Context, r manifest.Repo) verifyRepo {
+	dir := ctx.RepoDir(r)
+	v := verifyRepo{ID: r.ID, Path: r.Path}
+	fail := func(class, format string, args ...any) {
+		v.Failures = append(v.Failures, verifyFailure{Class: class, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !git.IsCloned(dir) {
+		if !r.IsRequired() {
+			v.Skipped = "optional repo not cloned"
+			return v
+		}
+		fail(verifyMissing, "not cloned")
+		return v
+	}
+
+	st, err := git.Status(dir)
+	switch {
+	case err != nil:
+		fail(verifyError, "cannot read status: %v", err)
+	case st.Dirty():
+		fail(verifyDirty, "%s", dirtyLabel(repoStatus{
+			Dirty: true, Staged: st.Staged, Modified: st.Modified, Untracked: st.Untracked, Conflicted: st.Conflicted,
+		}))
+	}
+
+	lr, ok := ctx.Lock.Repos[r.ID]
+	if !ok {
+		fail(verifyCommit, "not in the lock")
+	} else if st != nil && st.Head != lr.Commit {
+		fail(verifyCommit, "HEAD %s, lock %s", shortSHA(st.Head), shortSHA(lr.Commit))
+	}
+
+	if !r.IsLocal() {
+		want := r.URL
+		if ok && lr.URL != "" {
+			want = lr.URL
+		}
+		if origin := originMismatch(dir, want); origin != "" {
+			fail(verifyOrigin, "origin %s, want %s", origin, want)
+		}
+	}
+	return v
+}
+
+// failedClasses returns the failure classes present in report, in exit code
+// order.
+func failedClasses(report verifyReport) []string {
+	seen := make(map[string]bool)
+	for _, r := range report.Repos {
+		for _, f := range r.Failures {
+			seen[f.Class] = true
+		}
+	}
+	var classes []string
+	for _, c := range verifyClasses {
+		if seen[c] {
+			classes = append(classes, c)
+		}
+	}
+	return classes
+}
+
+func printVerifyReport(out io.Writer, report verifyReport) error {
+	tbl := ui.NewTable(out, "REPO", "RESULT", "DETAILS")
+	failures := 0
+	for _, r := range report.Repos {
+		switch {
+		case r.Skipped != "":
+			tbl.Row(r.ID, "skipped", r.Skipped)
+		case len(r.Failures) == 0:
+			tbl.Row(r.ID, "ok", "")
+		default:
+			for i, f := range r.Failures {
+				id := r.ID
+				if i > 0 {
+					id = ""
+				}
+				tbl.Row(id, f.Class, f.Message)
+				failures++
+			}
+		}
+	}
+	if err := tbl.Flush(); err != nil {
+		return err
+	}
+	if report.OK {
+		_, _ = fmt.Fprintf(out, "Workspace matches %s.\n", report.Lock)
+		return nil
+	}
+	_, _ = fmt.Fprintf(out, "%d problem(s) (exit code %d).\n", failures, report.ExitCode)
+	return nil
+}
+
+// JUnit XML report: one test case per repo, with a failure element per
+// failed check.
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Failures  []junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped  `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func writeVerifyJUnit(path string, report verifyReport) error {
+	suite := junitSuite{Name: "agentws verify"}
+	for _, r := range report.Repos {
+		c := junitCase{Name: r.ID, ClassName: "agentws.verify"}
+		if r.Skipped != "" {
+			c.Skipped = &junitSkipped{Message: r.Skipped}
+			suite.Skipped++
+		}
+		for _, f := range r.Failures {
+			c.Failures = append(c.Failures, junitFailure{Type: f.Class, Message: f.Message})
+		}
+		if len(c.Failures) > 0 {
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Tests = len(suite.Cases)
+
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding JUnit report: %w", err)
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing JUnit report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fbkclanna/agentws/internal/manifest"
+)
+
+// runVerifyCmd runs agentws verify and returns stdout and the exit code the
+// process would end with.
+func runVerifyCmd(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	var buf bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&buf)
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs(append([]string{"verify"}, args...))
+	err := root.Execute()
+	if err == nil {
+		return buf.String(), 0
+	}
+	var ee *exitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("verify failed without an exit code: %v", err)
+	}
+	return buf.String(), ee.ExitCode()
+}
+
+func TestRunVerify_clean(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+
+	out, code := runVerifyCmd(t, "--root", wsDir)
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0\n%s", code, out)
+	}
+	if !strings.Contains(out, "Workspace matches workspace.lock.yaml") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestRunVerify_noLock(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"verify", "--root", wsDir})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "no workspace.lock.yaml") {
+		t.Errorf("expected missing lock error, got %v", err)
+	}
+}
+
+func TestRunVerify_failureClasses(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 3)
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	repos := filepath.Join(wsDir, "repos")
+
+	// backend: dirty and on a different commit.
+	backend := filepath.Join(repos, "backend")
+	gitCmd := exec.Command("git", "-C", backend, "-c", "user.name=T", "-c", "user.email=t@example.com", "commit", "--allow-empty", "-m", "local")
+	if out, err := gitCmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(backend, "dirty.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// frontend: wrong origin.
+	if out, err := exec.Command("git", "-C", filepath.Join(repos, "frontend"), "remote", "set-url", "origin", "/elsewhere.git").CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	// infra: missing.
+	if err := os.RemoveAll(filepath.Join(repos, "infra")); err != nil {
+		t.Fatal(err)
+	}
+	// An unmanaged repo under repos_root.
+	if out, err := exec.Command("git", "init", filepath.Join(repos, "stray")).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	junit := filepath.Join(t.TempDir(), "verify.xml")
+	out, code := runVerifyCmd(t, "--root", wsDir, "--json", "--junit", junit)
+	if want := 2 + 4 + 8 + 16 + 32; code != want {
+		t.Errorf("exit code = %d, want %d", code, want)
+	}
+
+	var report verifyReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if report.OK || report.ExitCode != code {
+		t.Errorf("unexpected report header: ok=%v exit_code=%d", report.OK, report.ExitCode)
+	}
+	classes := map[string][]string{}
+	for _, r := range report.Repos {
+		for _, f := range r.Failures {
+			classes[r.ID] = append(classes[r.ID], f.Class)
+		}
+	}
+	for id, want := range map[string]string{
+		"backend":     "dirty,commit",
+		"frontend":    "origin",
+		"infra":       "missing",
+		"repos/stray": "unmanaged",
+	} {
+		if got := strings.Join(classes[id], ","); got != want {
+			t.Errorf("%s: failures = %q, want %q", id, got, want)
+		}
+	}
+
+	data, err := os.ReadFile(junit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suite junitSuite
+	if err := xml.Unmarshal(data, &suite); err != nil {
+		t.Fatalf("invalid JUnit XML: %v", err)
+	}
+	if suite.Tests != 4 || suite.Failures != 4 {
+		t.Errorf("junit tests=%d failures=%d, want 4 and 4", suite.Tests, suite.Failures)
+	}
+}
+
+func TestRunVerify_singleClassExitCode(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	if err := os.WriteFile(filepath.Join(wsDir, "repos", "backend", "dirty.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, code := runVerifyCmd(t, "--root", wsDir)
+	if code != 4 {
+		t.Errorf("exit code = %d, want 4 (dirty)", code)
+	}
+	if !strings.Contains(out, "1 untracked") {
+		t.Errorf("expected dirty details in output:\n%s", out)
+	}
+}
+
+func TestRunVerify_unreadableStatus(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	if err := os.WriteFile(filepath.Join(wsDir, "repos", "backend", ".git", "index"), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, code := runVerifyCmd(t, "--root", wsDir)
+	if code != 64 {
+		t.Errorf("exit code = %d, want 64 (error), not dirty\n%s", code, out)
+	}
+	if !strings.Contains(out, "cannot read status") {
+		t.Errorf("expected the status error in output:\n%s", out)
+	}
+}
+
+func TestRunVerify_lockEntryNotInManifest(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	if err := os.RemoveAll(filepath.Join(wsDir, "repos", "frontend")); err != nil {
+		t.Fatal(err)
+	}
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos = ws.Repos[:1]
+	})
+
+	out, code := runVerifyCmd(t, "--root", wsDir, "--json")
+	if code != 8 {
+		t.Errorf("exit code = %d, want 8 (commit)\n%s", code, out)
+	}
+	var report verifyReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	var found bool
+	for _, r := range report.Repos {
+		if r.ID == "frontend" {
+			found = len(r.Failures) == 1 && r.Failures[0].Class == verifyCommit
+		}
+	}
+	if !found {
+		t.Errorf("expected a commit failure for frontend, got %+v", report.Repos)
+	}
+}
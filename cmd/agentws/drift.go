@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/lock"
+	"github.com/fbkclanna/agentws/internal/manifest"
+)
+
+// cloneOptions returns the clone settings the manifest asks for.
+func cloneOptions(r manifest.Repo, d manifest.Defaults) git.CloneOpts {
+	return git.CloneOpts{
+		Depth:        r.EffectiveDepth(d),
+		PartialClone: r.EffectivePartialClone(d),
+		Sparse:       r.Sparse,
+		NoCone:       !r.SparseConeMode(),
+	}
+}
+
+// cloneDrift is a mismatch between the manifest's clone settings (sparse,
+// depth, partial_clone) and an existing clone.
+type cloneDrift struct {
+	detail string
+	// fix applies the manifest setting in place; nil if that is not
+	// possible without re-cloning.
+	fix func(cctx context.Context) error
+}
+
+// detectCloneDrift compares an existing clone with the settings the manifest
+// would have used to clone it.
+func detectCloneDrift(dir string, r manifest.Repo, d manifest.Defaults) ([]cloneDrift, error) {
+	if r.IsLocal() {
+		return nil, nil
+	}
+	var drift []cloneDrift
+
+	sparse, err := sparseDrift(dir, r)
+	if err != nil {
+		return nil, err
+	}
+	drift = append(drift, sparse...)
+
+	depth, err := depthDrift(dir, r, d)
+	if err != nil {
+		return nil, err
+	}
+	drift = append(drift, depth...)
+
+	return append(drift, partialCloneDrift(dir, r, d)...), nil
+}
+
+func sparseDrift(dir string, r manifest.Repo) ([]cloneDrift, error) {
+	st, err := git.SparseCheckout(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading sparse-checkout: %w", err)
+	}
+	want := r.SparseEnabled()
+	cone := r.SparseConeMode()
+
+	switch {
+	case !want && !st.Enabled:
+		return nil, nil
+	case !want:
+		return []cloneDrift{{
+			detail: "sparse-checkout enabled, manifest wants full checkout",
+			fix:    func(context.Context) error { return git.SparseCheckoutDisable(dir) },
+		}}, nil
+	case st.Enabled && st.Cone == cone && samePaths(st.Paths, r.Sparse, cone):
+		return nil, nil
+	}
+
+	var detail string
+	switch {
+	case !st.Enabled:
+		detail = "full checkout, manifest wants sparse-checkout"
+	case st.Cone != cone:
+		detail = fmt.Sprintf("sparse-checkout cone mode is %s, manifest wants %s", onOff(st.Cone), onOff(cone))
+	default:
+		detail = fmt.Sprintf("sparse paths [%s], manifest wants [%s]", strings.Join(st.Paths, " "), strings.Join(r.Sparse, " "))
+	}
+	return []cloneDrift{{
+		detail: detail,
+		fix:    func(context.Context) error { return git.SparseCheckoutSet(dir, r.Sparse, cone) },
+	}}, nil
+}
+
+func depthDrift(dir string, r manifest.Repo, d manifest.Defaults) ([]cloneDrift, error) {
+	if !git.IsShallow(dir) {
+		// A full history satisfies any depth; reducing depth in place is
+		// not worth it.
+		return nil, nil
+	}
+	depth := r.EffectiveDepth(d)
+	if depth == nil || *depth <= 0 {
+		return []cloneDrift{{
+			detail: "shallow clone, manifest wants full history",
+			fix:    func(cctx context.Context) error { return git.Unshallow(cctx, dir) },
+		}}, nil
+	}
+	have, err := git.HistoryDepth(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading history depth: %w", err)
+	}
+	if have >= *depth {
+		return nil, nil
+	}
+	missing := *depth - have
+	return []cloneDrift{{
+		detail: fmt.Sprintf("history depth %d, manifest wants %d", have, *depth),
+		fix:    func(cctx context.Context) error { return git.Deepen(cctx, dir, missing) },
+	}}, nil
+}
+
+func partialCloneDrift(dir string, r manifest.Repo, d manifest.Defaults) []cloneDrift {
+	filter := git.PartialCloneFilter(dir)
+	want := r.EffectivePartialClone(d)
+	switch {
+	case want && filter == "":
+		return []cloneDrift{{
+			detail: "not a partial clone, manifest wants partial_clone",
+			fix:    func(cctx context.Context) error { return git.EnablePartialClone(cctx, dir) },
+		}}
+	case !want && filter != "":
+		return []cloneDrift{{
+			detail: fmt.Sprintf("partial clone (filter %s), manifest disables partial_clone; re-clone to change", filter),
+		}}
+	}
+	return nil
+}
+
+// lockDrift compares a clone with its entry in lf and describes every
+// recorded field that no longer matches, e.g. "lock=abc1234". It returns nil
+// for repos that are not locked. Locks written before schema 2 only record
+// the commit and URL.
+func lockDrift(dir string, r manifest.Repo, lf *lock.File, st *git.RepoStatus) []string {
+	lr, ok := lf.Repos[r.ID]
+	if !ok {
+		return nil
+	}
+	var drift []string
+	if st.Head != "" && st.Head != lr.Commit {
+		drift = append(drift, "lock="+shortSHA(lr.Commit))
+	}
+	if lr.Branch != "" && st.Branch != "" && st.Branch != lr.Branch {
+		drift = append(drift, "branch "+lr.Branch)
+	}
+	if !r.IsLocal() && lr.URL != "" && !sameRemoteURL(lr.URL, r.URL) {
+		if origin := originMismatch(dir, lr.URL); origin != "" {
+			drift = append(drift, "url "+lr.URL)
+		}
+	}
+	if !lf.HasCloneState() {
+		return drift
+	}
+
+	if sp, err := git.SparseCheckout(dir); err == nil {
+		switch {
+		case lr.Sparse == nil && sp.Enabled:
+			drift = append(drift, "full checkout")
+		case lr.Sparse != nil && (!sp.Enabled || sp.Cone != lr.Sparse.Cone || !samePaths(sp.Paths, lr.Sparse.Paths, lr.Sparse.Cone)):
+			drift = append(drift, fmt.Sprintf("sparse [%s]", strings.Join(lr.Sparse.Paths, " ")))
+		}
+	}
+
+	shallow := git.IsShallow(dir)
+	switch {
+	case lr.Depth > 0 && !shallow:
+		drift = append(drift, fmt.Sprintf("depth %d", lr.Depth))
+	case lr.Depth == 0 && shallow:
+		drift = append(drift, "full history")
+	}
+
+	if subs, err := git.Submodules(dir); err == nil {
+		current := make(map[string]string, len(subs))
+		for _, sub := range subs {
+			if sub.Initialized {
+				current[sub.Path] = sub.Commit
+			}
+		}
+		for _, sub := range lr.Submodules {
+			if current[sub.Path] != sub.Commit {
+				drift = append(drift, fmt.Sprintf("submodule %s=%s", sub.Path, shortSHA(sub.Commit)))
+			}
+		}
+	}
+
+	if lr.Dirty {
+		drift = append(drift, "pinned dirty")
+	}
+	return drift
+}
+
+// remoteDrift returns a description of the mismatch if origin of an existing
+// clone no longer points at the manifest URL, or "" if it matches.
+func remoteDrift(dir string, r manifest.Repo) string {
+	if r.IsLocal() {
+		return ""
+	}
+	if origin := originMismatch(dir, r.URL); origin != "" {
+		return fmt.Sprintf("origin URL differs from manifest (origin: %s)", origin)
+	}
+	return ""
+}
+
+// originMismatch returns the origin URL of the clone at dir if it differs
+// from url, or "" if it matches or cannot be read.
+func originMismatch(dir, url string) string {
+	origin, err := git.RemoteURL(dir)
+	if err != nil || sameRemoteURL(origin, url) {
+		return ""
+	}
+	return origin
+}
+
+// sameRemoteURL compares remote URLs ignoring a trailing slash or ".git".
+func sameRemoteURL(a, b string) bool {
+	norm := func(u string) string {
+		return strings.TrimSuffix(strings.TrimRight(u, "/"), ".git")
+	}
+	return norm(a) == norm(b)
+}
+
+// samePaths compares sparse paths ignoring order and, in cone mode, leading
+// and trailing slashes.
+func samePaths(have, want []string, cone bool) bool {
+	norm := func(paths []string) map[string]bool {
+		set := make(map[string]bool, len(paths))
+		for _, p := range paths {
+			if cone {
+				p = strings.Trim(p, "/")
+			}
+			set[p] = true
+		}
+		return set
+	}
+	a, b := norm(have), norm(want)
+	if len(a) != len(b) {
+		return false
+	}
+	for p := range a {
+		if !b[p] {
+			return false
+		}
+	}
+	return true
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
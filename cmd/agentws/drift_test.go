@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/manifest"
+)
+
+// editManifest loads workspace.yaml, applies edit and saves it.
+func editManifest(t *testing.T, wsDir string, edit func(ws *manifest.Workspace)) {
+	t.Helper()
+	path := filepath.Join(wsDir, "workspace.yaml")
+	ws, err := manifest.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(ws)
+	if err := manifest.Save(path, ws); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func runAgentws(t *testing.T, args ...string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&buf)
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs(args)
+	if err := root.Execute(); err != nil {
+		t.Fatalf("agentws %s failed: %v", strings.Join(args, " "), err)
+	}
+	return buf.String()
+}
+
+func TestSync_reconcilesSparseCheckout(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync")
+	dir := filepath.Join(wsDir, "repos", "backend")
+
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].Sparse = []string{"docs"}
+	})
+	if out := runAgentws(t, "--root", wsDir, "status", "--json"); !strings.Contains(out, "manifest wants sparse-checkout") {
+		t.Errorf("status should report sparse drift: %s", out)
+	}
+
+	runAgentws(t, "--root", wsDir, "sync")
+	st, err := git.SparseCheckout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Enabled || !st.Cone || len(st.Paths) != 1 || st.Paths[0] != "docs" {
+		t.Errorf("sparse-checkout not applied: %+v", st)
+	}
+	if out := runAgentws(t, "--root", wsDir, "status", "--json"); strings.Contains(out, "drift") {
+		t.Errorf("no drift expected after sync: %s", out)
+	}
+
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].Sparse = nil
+	})
+	runAgentws(t, "--root", wsDir, "sync")
+	if st, _ := git.SparseCheckout(dir); st.Enabled {
+		t.Error("sparse-checkout should be disabled when removed from the manifest")
+	}
+}
+
+func TestSync_deprecatedSparseCheckoutIgnored(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	runAgentws(t, "--root", wsDir, "sync", "--only", "backend")
+	enabled := true
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Defaults.SparseCheckout = &enabled
+	})
+
+	var stderr bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr.String(), "Warning: defaults.sparse_checkout is deprecated and ignored") {
+		t.Errorf("expected a deprecation warning, got:\n%s", stderr.String())
+	}
+
+	// Neither the existing clone nor the new one lists sparse paths, so both
+	// keep a full checkout.
+	for _, id := range []string{"backend", "frontend"} {
+		dir := filepath.Join(wsDir, "repos", id)
+		st, err := git.SparseCheckout(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Enabled {
+			t.Errorf("%s: sparse-checkout enabled without sparse paths", id)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "README.md")); err != nil {
+			t.Errorf("%s: expected a full checkout: %v", id, err)
+		}
+	}
+	if out := runAgentws(t, "--root", wsDir, "status", "--json"); strings.Contains(out, "drift") {
+		t.Errorf("no drift expected: %s", out)
+	}
+}
+
+func TestSync_reconcilesDepthAndPartialClone(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+	if out, err := exec.Command("git", "-C", bareRepos[0], "config", "uploadpack.allowFilter", "true").CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	depth := 1
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].URL = "file://" + bareRepos[0]
+		ws.Repos[0].Depth = &depth
+	})
+	runAgentws(t, "--root", wsDir, "sync")
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if !git.IsShallow(dir) {
+		t.Fatal("expected a shallow clone")
+	}
+
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].Depth = nil
+		ws.Defaults.PartialClone = true
+	})
+	out := runAgentws(t, "--root", wsDir, "status", "--json")
+	if !strings.Contains(out, "manifest wants full history") || !strings.Contains(out, "manifest wants partial_clone") {
+		t.Errorf("status should report depth and partial clone drift: %s", out)
+	}
+
+	runAgentws(t, "--root", wsDir, "sync")
+	if git.IsShallow(dir) {
+		t.Error("clone should be unshallowed")
+	}
+	if f := git.PartialCloneFilter(dir); f != "blob:none" {
+		t.Errorf("partial clone filter = %q, want blob:none", f)
+	}
+}
+
+func TestSync_fixRemotes(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync")
+	dir := filepath.Join(wsDir, "repos", "backend")
+
+	// Move the repo to a new location with the same history.
+	moved := filepath.Join(t.TempDir(), "moved.git")
+	if out, err := exec.Command("git", "clone", "--bare", bareRepos[0], moved).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].URL = moved
+	})
+
+	out := runAgentws(t, "--root", wsDir, "status", "--json")
+	if !strings.Contains(out, "origin URL differs from manifest") {
+		t.Errorf("status should report remote drift: %s", out)
+	}
+
+	runAgentws(t, "--root", wsDir, "sync")
+	if url, _ := git.RemoteURL(dir); url != bareRepos[0] {
+		t.Errorf("sync without --fix-remotes changed origin to %s", url)
+	}
+
+	runAgentws(t, "--root", wsDir, "sync", "--fix-remotes")
+	if url, _ := git.RemoteURL(dir); url != moved {
+		t.Errorf("origin = %s, want %s", url, moved)
+	}
+	if out := runAgentws(t, "--root", wsDir, "status", "--json"); strings.Contains(out, "origin URL differs") {
+		t.Errorf("drift should be gone after --fix-remotes: %s", out)
+	}
+}
+
+func TestSync_fixRemotesUnrelatedHistory(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync")
+	dir := filepath.Join(wsDir, "repos", "backend")
+
+	// A repo with a different root commit.
+	work := filepath.Join(t.TempDir(), "other")
+	for _, args := range [][]string{
+		{"init", "-b", "main", work},
+		{"-C", work, "-c", "user.name=Other", "-c", "user.email=other@example.com", "commit", "--allow-empty", "-m", "unrelated root"},
+		{"clone", "--bare", work, work + ".git"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	unrelated := work + ".git"
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].URL = unrelated
+	})
+
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync", "--fix-remotes"})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "no history in common") {
+		t.Fatalf("expected unrelated history error, got %v", err)
+	}
+	if url, _ := git.RemoteURL(dir); url != bareRepos[0] {
+		t.Errorf("origin should be unchanged, got %s", url)
+	}
+
+	// --force is about dirty trees and pruning; it does not allow switching
+	// to an unrelated history.
+	root = newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync", "--fix-remotes", "--force"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "no history in common") {
+		t.Fatalf("expected unrelated history error with --force, got %v", err)
+	}
+
+	root = newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync", "--allow-unrelated"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "requires --fix-remotes") {
+		t.Fatalf("expected --allow-unrelated to require --fix-remotes, got %v", err)
+	}
+
+	root = newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync", "--fix-remotes", "--allow-unrelated"})
+	_ = root.Execute()
+	if url, _ := git.RemoteURL(dir); url != unrelated {
+		t.Errorf("--allow-unrelated should switch origin, got %s", url)
+	}
+}
+
+func TestSync_lockReconcilesWithLocalCommit(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+	depth := 1
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].URL = "file://" + bareRepos[0]
+		ws.Repos[0].Depth = &depth
+	})
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if !git.IsShallow(dir) {
+		t.Fatal("expected a shallow clone")
+	}
+
+	// The locked commit is already local, so nothing is fetched, but the
+	// clone settings must still follow the manifest.
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].Depth = nil
+	})
+	out := runAgentws(t, "--root", wsDir, "sync", "--lock", "--json")
+	var results []syncResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if results[0].Action != syncCheckedOut || len(results[0].Reconciled) == 0 {
+		t.Errorf("expected a reconciled checkout from the lock: %+v", results[0])
+	}
+	if git.IsShallow(dir) {
+		t.Error("clone should be unshallowed")
+	}
+}
+
+func TestSync_lockRestoresSparseCheckout(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync")
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if err := git.SparseCheckoutSet(dir, []string{"docs"}, true); err != nil {
+		t.Fatal(err)
+	}
+	runAgentws(t, "--root", wsDir, "pin")
+
+	if err := git.SparseCheckoutDisable(dir); err != nil {
+		t.Fatal(err)
+	}
+	if out := runAgentws(t, "--root", wsDir, "status", "--json"); !strings.Contains(out, `"lock_diff": "sparse [docs]"`) {
+		t.Errorf("status should report sparse drift from the lock: %s", out)
+	}
+
+	runAgentws(t, "--root", wsDir, "sync", "--lock")
+	st, err := git.SparseCheckout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Enabled || len(st.Paths) != 1 || st.Paths[0] != "docs" {
+		t.Errorf("sparse-checkout not restored from the lock: %+v", st)
+	}
+	if out := runAgentws(t, "--root", wsDir, "status", "--json"); strings.Contains(out, "lock_diff") {
+		t.Errorf("no lock drift expected after sync --lock: %s", out)
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"os/exec"
 	"path/filepath"
 
@@ -10,7 +10,8 @@ import (
 )
 
 // execCmd runs a PostSync command safely (no shell expansion).
-func execCmd(repoDir string, ps manifest.PostSync) error {
+// The command's stdout and stderr are both written to out.
+func execCmd(repoDir string, ps manifest.PostSync, out io.Writer) error {
 	if len(ps.Cmd) == 0 {
 		return fmt.Errorf("empty cmd")
 	}
@@ -22,7 +23,7 @@ func execCmd(repoDir string, ps manifest.PostSync) error {
 
 	cmd := exec.Command(ps.Cmd[0], ps.Cmd[1:]...)
 	cmd.Dir = dir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = out
+	cmd.Stderr = out
 	return cmd.Run()
 }
@@ -0,0 +1,13 @@
+package main
+
+// exitError is an error that asks main to exit with a specific status code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// ExitCode returns the process exit status for the error.
+func (e *exitError) ExitCode() int { return e.code }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/lock"
+	"github.com/fbkclanna/agentws/internal/workspace"
+	"github.com/spf13/cobra"
+)
+
+// lockCommitOptions controls whether pin and sync --update-lock commit the
+// lock file to the workspace git repository.
+type lockCommitOptions struct {
+	commit bool
+	push   bool
+}
+
+func addLockCommitFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("commit", false, "Commit the lock file to the workspace git repo (default: defaults.commit_lock)")
+	cmd.Flags().Bool("push", false, "Push the lock commit to the upstream of the workspace repo (implies --commit)")
+}
+
+// lockCommitSettings combines --commit/--push with defaults.commit_lock. An
+// explicit --commit=false overrides the manifest.
+func lockCommitSettings(cmd *cobra.Command, ctx *workspace.Context) lockCommitOptions {
+	opts := lockCommitOptions{commit: ctx.Manifest.Defaults.CommitLock}
+	if cmd.Flags().Changed("commit") {
+		opts.commit, _ = cmd.Flags().GetBool("commit")
+	}
+	opts.push, _ = cmd.Flags().GetBool("push")
+	if opts.push {
+		opts.commit = true
+	}
+	return opts
+}
+
+// lockChange is a repo whose locked commit differs from the committed lock.
+// old or new is empty for repos added to or removed from the lock.
+type lockChange struct {
+	id       string
+	old, new string
+}
+
+// commitLock commits the lock file at ctx.LockPath to the workspace git
+// repository, with a message listing the repos whose locked commit changed
+// since the last committed version. Nothing is committed when no locked
+// commit changed; the lock file is then restored to its committed version,
+// so that a rewrite with only a new generated_at does not leave the workspace
+// repository dirty.
+func commitLock(cctx context.Context, ctx *workspace.Context, opts lockCommitOptions, out io.Writer) error {
+	if !git.IsCloned(ctx.Root) {
+		return fmt.Errorf("cannot commit the lock: %s is not a git repository (see agentws init)", ctx.Root)
+	}
+	rel, err := filepath.Rel(ctx.Root, ctx.LockPath)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+
+	lf, err := lock.Load(ctx.LockPath)
+	if err != nil {
+		return err
+	}
+	var prev *lock.File
+	data, ok, err := git.FileAt(ctx.Root, "HEAD", rel)
+	if err != nil {
+		return fmt.Errorf("reading committed %s: %w", rel, err)
+	}
+	if ok {
+		if prev, err = lock.Parse([]byte(data)); err != nil {
+			return fmt.Errorf("committed %s: %w", rel, err)
+		}
+	}
+
+	changes := lockChanges(prev, lf)
+	if len(changes) == 0 {
+		if ok {
+			if err := git.CheckoutFile(ctx.Root, "HEAD", rel); err != nil {
+				return fmt.Errorf("restoring %s: %w", rel, err)
+			}
+		}
+		_, _ = fmt.Fprintf(out, "No locked commits changed; %s not committed.\n", rel)
+		return nil
+	}
+	if err := git.Add(ctx.Root, rel); err != nil {
+		return fmt.Errorf("staging %s: %w", rel, err)
+	}
+	if err := git.Commit(ctx.Root, lockCommitMessage(rel, changes), rel); err != nil {
+		return fmt.Errorf("committing %s: %w", rel, err)
+	}
+	_, _ = fmt.Fprintf(out, "Committed %s (%d repo(s) changed).\n", rel, len(changes))
+
+	if !opts.push {
+		return nil
+	}
+	if err := git.Push(cctx, ctx.Root); err != nil {
+		return fmt.Errorf("pushing lock commit: %w", err)
+	}
+	_, _ = fmt.Fprintln(out, "Pushed lock commit.")
+	return nil
+}
+
+// lockChanges lists the repos whose locked commit differs between prev (nil
+// if there was no lock) and next, sorted by ID.
+func lockChanges(prev, next *lock.File) []lockChange {
+	commits := func(lf *lock.File) map[string]string {
+		m := make(map[string]string)
+		if lf != nil {
+			for id, r := range lf.Repos {
+				m[id] = r.Commit
+			}
+		}
+		return m
+	}
+	old, cur := commits(prev), commits(next)
+
+	var changes []lockChange
+	for id, c := range cur {
+		if old[id] != c {
+			changes = append(changes, lockChange{id: id, old: old[id], new: c})
+		}
+	}
+	for id, c := range old {
+		if _, ok := cur[id]; !ok {
+			changes = append(changes, lockChange{id: id, old: c})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].id < changes[j].id })
+	return changes
+}
+
+// lockCommitMessage names the changed repos in the subject (or counts them
+// if there are many) and lists old and new short SHAs in the body, e.g.
+//
+//	Update workspace.lock.yaml: backend, frontend
+//
+//	backend   a1b2c3d -> e4f5a6b
+//	frontend  (new) -> 0c9d8e7
+func lockCommitMessage(rel string, changes []lockChange) string {
+	ids := make([]string, len(changes))
+	width := 0
+	for i, c := range changes {
+		ids[i] = c.id
+		width = max(width, len(c.id))
+	}
+	subject := fmt.Sprintf("Update %s: %s", rel, strings.Join(ids, ", "))
+	if len(changes) > 3 {
+		subject = fmt.Sprintf("Update %s: %d repos", rel, len(changes))
+	}
+
+	var b strings.Builder
+	b.WriteString(subject + "\n\n")
+	for _, c := range changes {
+		old, cur := "(new)", "(removed)"
+		if c.old != "" {
+			old = shortSHA(c.old)
+		}
+		if c.new != "" {
+			cur = shortSHA(c.new)
+		}
+		_, _ = fmt.Fprintf(&b, "%-*s  %s -> %s\n", width, c.id, old, cur)
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fbkclanna/agentws/internal/lock"
+)
+
+func TestLockChanges(t *testing.T) {
+	prev := &lock.File{Repos: map[string]*lock.Repo{
+		"backend":  {Commit: "1111111111"},
+		"frontend": {Commit: "2222222222"},
+		"infra":    {Commit: "3333333333"},
+	}}
+	next := &lock.File{Repos: map[string]*lock.Repo{
+		"analytics": {Commit: "4444444444"},
+		"backend":   {Commit: "5555555555"},
+		"frontend":  {Commit: "2222222222"},
+	}}
+
+	got := lockChanges(prev, next)
+	want := []lockChange{
+		{id: "analytics", new: "4444444444"},
+		{id: "backend", old: "1111111111", new: "5555555555"},
+		{id: "infra", old: "3333333333"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("change %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if n := len(lockChanges(nil, next)); n != 3 {
+		t.Errorf("without a previous lock every repo is new, got %d changes", n)
+	}
+}
+
+func TestLockCommitMessage(t *testing.T) {
+	changes := []lockChange{
+		{id: "analytics", new: "4444444444"},
+		{id: "backend", old: "1111111111", new: "5555555555"},
+		{id: "infra", old: "3333333333"},
+	}
+	want := `Update workspace.lock.yaml: analytics, backend, infra
+
+analytics  (new) -> 4444444
+backend    1111111 -> 5555555
+infra      3333333 -> (removed)
+`
+	if got := lockCommitMessage("workspace.lock.yaml", changes); got != want {
+		t.Errorf("message =\n%s\nwant\n%s", got, want)
+	}
+
+	many := append(changes, lockChange{id: "web", new: "6666666666"})
+	if got := lockCommitMessage(".agentws/locks/rc.lock.yaml", many); !strings.HasPrefix(got, "Update .agentws/locks/rc.lock.yaml: 4 repos\n\n") {
+		t.Errorf("many repos should be counted in the subject:\n%s", got)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fbkclanna/agentws/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// Values accepted by --output.
+const (
+	outputText   = "text"
+	outputNDJSON = "ndjson"
+)
+
+// addOutputFlag registers --output on commands that report per-repo progress.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().String("output", outputText, "Progress output format: text, ndjson (one JSON event per line on stdout)")
+}
+
+// ndjsonOutput reports whether --output ndjson was requested.
+func ndjsonOutput(cmd *cobra.Command) (bool, error) {
+	output, _ := cmd.Flags().GetString("output")
+	switch output {
+	case outputText:
+		return false, nil
+	case outputNDJSON:
+		return true, nil
+	}
+	return false, fmt.Errorf("--output must be %s or %s (got %q)", outputText, outputNDJSON, output)
+}
+
+// newProgress returns the progress sink for total repos: NDJSON events on
+// stdout, or the text counter display on stderr.
+func newProgress(cmd *cobra.Command, ndjson bool, total int) *ui.Progress {
+	if ndjson {
+		return ui.NewNDJSONProgress(cmd.OutOrStdout(), total)
+	}
+	return ui.NewProgress(cmd.ErrOrStderr(), total)
+}
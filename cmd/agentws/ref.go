@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/lock"
+	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/ui"
+)
+
+// defaultBranch returns the default branch of r, trying in order: origin/HEAD
+// of the clone at dir, the branch cached in lf, the remote HEAD (only when
+// not cloned yet) and finally manifest.DefaultRef.
+func defaultBranch(dir string, r manifest.Repo, lf *lock.File) string {
+	if r.IsLocal() {
+		return manifest.DefaultRef
+	}
+	cloned := git.IsCloned(dir)
+	if cloned {
+		if b := git.OriginHead(dir); b != "" {
+			return b
+		}
+	}
+	if lf != nil {
+		if lr, ok := lf.Repos[r.ID]; ok && lr.DefaultBranch != "" && sameRemoteURL(lr.URL, r.URL) {
+			return lr.DefaultBranch
+		}
+	}
+	if !cloned {
+		if b, err := git.DefaultBranch(r.URL); err == nil {
+			return b
+		}
+	}
+	return manifest.DefaultRef
+}
+
+// withResolvedRef returns r with an empty ref replaced by its default branch.
+func withResolvedRef(dir string, r manifest.Repo, lf *lock.File) manifest.Repo {
+	if r.Ref == "" {
+		r.Ref = defaultBranch(dir, r, lf)
+	}
+	return r
+}
+
+// lockEntry records the current HEAD of the clone at dir for the lock file.
+func lockEntry(dir string, r manifest.Repo, lf *lock.File) (*lock.Repo, error) {
+	commit, err := git.HeadCommitFull(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading HEAD for %s: %w", r.ID, err)
+	}
+	resolved := withResolvedRef(dir, r, lf)
+	lr := &lock.Repo{
+		URL:     r.URL,
+		Ref:     resolved.Ref,
+		RefType: refTypeOrBranch(dir, resolved),
+		Commit:  commit,
+	}
+	if r.Ref == "" {
+		lr.DefaultBranch = resolved.Ref
+	}
+	if err := recordCloneState(dir, lr); err != nil {
+		return nil, fmt.Errorf("reading state of %s: %w", r.ID, err)
+	}
+	return lr, nil
+}
+
+// recordCloneState fills in the parts of a lock entry that describe the
+// clone beyond its commit: branch, commit time, sparse-checkout, depth,
+// submodule commits and whether the worktree was dirty.
+func recordCloneState(dir string, lr *lock.Repo) error {
+	var err error
+	if lr.Branch, err = git.CurrentBranch(dir); err != nil {
+		return err
+	}
+	if lr.CommitTime, err = git.CommitTime(dir, lr.Commit); err != nil {
+		return err
+	}
+
+	sp, err := git.SparseCheckout(dir)
+	if err != nil {
+		return err
+	}
+	if sp.Enabled {
+		lr.Sparse = &lock.Sparse{Cone: sp.Cone, Paths: sp.Paths}
+	}
+	if git.IsShallow(dir) {
+		if lr.Depth, err = git.HistoryDepth(dir); err != nil {
+			return err
+		}
+	}
+
+	subs, err := git.Submodules(dir)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if sub.Initialized {
+			lr.Submodules = append(lr.Submodules, lock.Submodule{Path: sub.Path, Commit: sub.Commit})
+		}
+	}
+
+	st, err := git.Status(dir)
+	if err != nil {
+		return err
+	}
+	lr.Dirty = st.Dirty()
+	return nil
+}
+
+// detectRefType returns the type of r's ref: the declared ref_type, or branch
+// or tag depending on which of them exists in the clone at dir. It returns ""
+// when neither is known locally.
+func detectRefType(dir string, r manifest.Repo) string {
+	if typ := r.DeclaredRefType(); typ != "" {
+		return typ
+	}
+	ref := r.EffectiveRef()
+	var isBranch bool
+	if r.IsLocal() {
+		isBranch, _ = git.BranchExists(dir, ref)
+	} else {
+		isBranch, _ = git.RemoteBranchExists(dir, ref)
+	}
+	if isBranch {
+		return manifest.RefBranch
+	}
+	if isTag, _ := git.TagExists(dir, ref); isTag {
+		return manifest.RefTag
+	}
+	return ""
+}
+
+// refTypeOrBranch is detectRefType with branch as the fallback, for
+// recording and displaying the ref type.
+func refTypeOrBranch(dir string, r manifest.Repo) string {
+	if typ := detectRefType(dir, r); typ != "" {
+		return typ
+	}
+	return manifest.RefBranch
+}
+
+// prepareRef makes sure the object r's ref names is present in the clone,
+// fetching a tag or commit that the regular fetch did not bring in, and
+// returns the ref type along with a note on how it was obtained.
+func prepareRef(cctx context.Context, dir string, r manifest.Repo, defaults manifest.Defaults, opts syncOptions, progress *ui.Progress) (typ, note string, err error) {
+	typ = detectRefType(dir, r)
+	if r.IsLocal() {
+		if typ == "" {
+			typ = manifest.RefBranch
+		}
+		return typ, "", nil
+	}
+	ref := r.EffectiveRef()
+
+	switch typ {
+	case manifest.RefCommit:
+		note, err = ensureCommit(cctx, dir, r.ID, ref, r.EffectiveDepth(defaults), opts, progress)
+		return typ, note, err
+	case manifest.RefTag:
+		if ok, _ := git.TagExists(dir, ref); ok {
+			return typ, "", nil
+		}
+		if err := fetchTag(cctx, dir, r, defaults, opts, progress); err != nil {
+			return "", "", fmt.Errorf("fetch tag %s: %w", ref, err)
+		}
+		return typ, "", nil
+	case manifest.RefBranch:
+		return typ, "", nil
+	}
+
+	// Unknown name. A local branch or revision can be checked out as is.
+	if ok, _ := git.BranchExists(dir, ref); ok {
+		return manifest.RefBranch, "", nil
+	}
+	if _, err := git.ResolveCommit(dir, ref); err == nil {
+		return manifest.RefBranch, "", nil
+	}
+	// Tags outside the fetched history are not fetched automatically; fetch
+	// one only if origin has it.
+	var refs map[string]string
+	err = withTimeout(cctx, opts.timeout, func(c context.Context) error {
+		var err error
+		refs, err = git.LsRemote(c, dir, "origin", "refs/tags/"+ref)
+		return err
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("looking up tag %s on origin: %w", ref, err)
+	}
+	if _, ok := refs["refs/tags/"+ref]; !ok {
+		return "", "", fmt.Errorf("unknown ref %q: no such branch or tag on origin", ref)
+	}
+	if err := fetchTag(cctx, dir, r, defaults, opts, progress); err != nil {
+		return "", "", fmt.Errorf("fetch tag %s: %w", ref, err)
+	}
+	return manifest.RefTag, "", nil
+}
+
+// fetchTag fetches r's ref as a tag, limited to the clone depth for shallow
+// clones.
+func fetchTag(cctx context.Context, dir string, r manifest.Repo, defaults manifest.Defaults, opts syncOptions, progress *ui.Progress) error {
+	depth := 0
+	if git.IsShallow(dir) {
+		depth = 1
+		if d := r.EffectiveDepth(defaults); d != nil && *d > 0 {
+			depth = *d
+		}
+	}
+	progress.Log("Fetching tag %s for %s ...", r.EffectiveRef(), r.ID)
+	return withTimeout(cctx, opts.timeout, func(c context.Context) error {
+		return git.FetchTag(c, dir, r.EffectiveRef(), depth)
+	})
+}
+
+// checkoutRef checks out a branch normally and a tag or commit detached.
+func checkoutRef(dir, ref, typ string) error {
+	switch typ {
+	case manifest.RefTag:
+		return git.CheckoutDetached(dir, "refs/tags/"+ref)
+	case manifest.RefCommit:
+		return git.CheckoutDetached(dir, ref)
+	}
+	return git.Checkout(dir, ref)
+}
+
+// onRef reports whether the clone is checked out at r's ref: on the branch,
+// or detached at the tag's or commit's commit.
+func onRef(dir string, r manifest.Repo, typ string, st *git.RepoStatus) bool {
+	ref := r.EffectiveRef()
+	switch typ {
+	case manifest.RefTag:
+		ref = "refs/tags/" + ref
+	case manifest.RefCommit:
+	default:
+		return st.Branch == ref
+	}
+	if st.Branch != "" {
+		return false
+	}
+	want, err := git.ResolveCommit(dir, ref)
+	return err == nil && want == st.Head
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/lock"
+	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/testutil"
+)
+
+// tagBare tags the current main of a bare repo and returns the tagged commit.
+func tagBare(t *testing.T, bare, tag string) string {
+	t.Helper()
+	if out, err := exec.Command("git", "-C", bare, "tag", tag, "main").CombinedOutput(); err != nil {
+		t.Fatalf("tag: %v\n%s", err, out)
+	}
+	out, err := exec.Command("git", "-C", bare, "rev-parse", "main").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestSync_tagRef(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+	tagged := tagBare(t, bareRepos[0], "v1.0.0")
+	testutil.PushNewCommit(t, bareRepos[0])
+	depth := 1
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].URL = "file://" + bareRepos[0]
+		ws.Repos[0].Ref = "v1.0.0"
+		ws.Repos[0].Depth = &depth
+	})
+
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	dir := filepath.Join(wsDir, "repos", "backend")
+	head, _ := git.HeadCommitFull(dir)
+	if head != tagged {
+		t.Errorf("HEAD = %s, want tagged commit %s", head, tagged)
+	}
+	if branch, _ := git.CurrentBranch(dir); branch != "" {
+		t.Errorf("tag checkout should be detached, on %s", branch)
+	}
+
+	var statuses []repoStatus
+	if err := json.Unmarshal([]byte(runAgentws(t, "--root", wsDir, "status", "--json")), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].RefType != manifest.RefTag || !statuses[0].RefMatch {
+		t.Errorf("expected matching tag ref, got %+v", statuses[0])
+	}
+
+	lf, err := lock.Load(filepath.Join(wsDir, "workspace.lock.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lr := lf.Repos["backend"]; lr.RefType != manifest.RefTag || lr.Commit != tagged {
+		t.Errorf("unexpected lock entry: %+v", lr)
+	}
+}
+
+func TestSync_unknownRef(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync")
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].Ref = "no-such-ref"
+	})
+
+	rec := &callRecorder{}
+	defer git.SetRunner(git.SetRunner(rec))
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"--root", wsDir, "sync", "--always-fetch"})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), `unknown ref "no-such-ref"`) {
+		t.Fatalf("expected unknown ref error, got %v", err)
+	}
+	fetches := 0
+	for _, c := range rec.calls {
+		if c == "fetch" {
+			fetches++
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("only the regular fetch should run, got %d fetches: %v", fetches, rec.calls)
+	}
+}
+
+func TestSync_commitRef(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+	pinned := tagBare(t, bareRepos[0], "unused")
+	testutil.PushNewCommits(t, bareRepos[0], 2)
+	depth := 1
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].URL = "file://" + bareRepos[0]
+		ws.Repos[0].Ref = pinned
+		ws.Repos[0].Depth = &depth
+	})
+
+	runAgentws(t, "--root", wsDir, "sync")
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if head, _ := git.HeadCommitFull(dir); head != pinned {
+		t.Errorf("HEAD = %s, want %s", head, pinned)
+	}
+
+	var statuses []repoStatus
+	if err := json.Unmarshal([]byte(runAgentws(t, "--root", wsDir, "status", "--json")), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].RefType != manifest.RefCommit || !statuses[0].RefMatch {
+		t.Errorf("expected matching commit ref, got %+v", statuses[0])
+	}
+}
+
+func TestSync_defaultBranchCachedInLock(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+	if out, err := exec.Command("git", "-C", bareRepos[0], "branch", "-m", "main", "master").CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].Ref = ""
+	})
+
+	runAgentws(t, "--root", wsDir, "sync", "--update-lock")
+	dir := filepath.Join(wsDir, "repos", "backend")
+	if branch, _ := git.CurrentBranch(dir); branch != "master" {
+		t.Errorf("expected default branch master, got %s", branch)
+	}
+	lf, err := lock.Load(filepath.Join(wsDir, "workspace.lock.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lr := lf.Repos["backend"]; lr.Ref != "master" || lr.DefaultBranch != "master" {
+		t.Errorf("unexpected lock entry: %+v", lr)
+	}
+}
+
+func TestDefaultBranch_fromLockWithoutClone(t *testing.T) {
+	r := manifest.Repo{ID: "svc", URL: "/nonexistent/svc.git"}
+	lf := &lock.File{Repos: map[string]*lock.Repo{
+		"svc": {URL: "/nonexistent/svc.git", Ref: "develop", DefaultBranch: "develop"},
+	}}
+	if got := defaultBranch(t.TempDir(), r, lf); got != "develop" {
+		t.Errorf("defaultBranch = %q, want develop from the lock", got)
+	}
+	if got := defaultBranch(t.TempDir(), r, nil); got != manifest.DefaultRef {
+		t.Errorf("defaultBranch = %q, want fallback %q", got, manifest.DefaultRef)
+	}
+}
@@ -1,27 +1,64 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/workspace"
 	"github.com/spf13/cobra"
 )
 
+// envTrace enables git tracing like --verbose when set to "1".
+const envTrace = "AGENTWS_TRACE"
+
+// warnDeprecations warns about deprecated manifest settings. Errors are left
+// to the command, which loads the manifest itself.
+func warnDeprecations(cmd *cobra.Command) {
+	root, _ := cmd.Flags().GetString("root")
+	ws, err := manifest.Load(filepath.Join(root, workspace.ManifestFile))
+	if err != nil {
+		return
+	}
+	for _, msg := range ws.Deprecations() {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s\n", msg)
+	}
+}
+
 func newRootCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "agentws",
 		Short:   "Multi-repo workspace manager for coding agents",
 		Version: version,
+		PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+			verbose, _ := cmd.Flags().GetBool("verbose")
+			if verbose || os.Getenv(envTrace) == "1" {
+				git.SetRunner(git.Trace(git.ExecRunner{}, cmd.ErrOrStderr()))
+			}
+			warnDeprecations(cmd)
+		},
 	}
 
 	cmd.PersistentFlags().String("root", ".", "Root directory for workspaces")
+	cmd.PersistentFlags().Bool("verbose", false, "Log every git invocation with its duration to stderr (also AGENTWS_TRACE=1)")
 
 	cmd.AddCommand(
 		newInitCmd(),
 		newAddCmd(),
 		newSyncCmd(),
 		newStatusCmd(),
+		newOutdatedCmd(),
 		newPinCmd(),
+		newLockCmd(),
+		newPruneCmd(),
+		newCacheCmd(),
+		newBundleCmd(),
 		newBranchesCmd(),
 		newCheckoutCmd(),
 		newStartCmd(),
+		newVerifyCmd(),
 		newDoctorCmd(),
 		newRunCmd(),
 	)
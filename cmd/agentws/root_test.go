@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fbkclanna/agentws/internal/git"
+)
+
+func TestRoot_verboseTracesGit(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	prev := git.SetRunner(git.ExecRunner{})
+	t.Cleanup(func() { git.SetRunner(prev) })
+
+	var stderr bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--root", wsDir, "--verbose", "sync"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(stderr.String(), "[trace] git clone") {
+		t.Errorf("expected traced clone in stderr, got:\n%s", stderr.String())
+	}
+}
+
+func TestRoot_traceEnv(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 1)
+	prev := git.SetRunner(git.ExecRunner{})
+	t.Cleanup(func() { git.SetRunner(prev) })
+	t.Setenv(envTrace, "1")
+
+	var stderr bytes.Buffer
+	root := newRootCmd()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--root", wsDir, "sync"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(stderr.String(), "[trace] git ") {
+		t.Errorf("expected trace lines with %s=1, got:\n%s", envTrace, stderr.String())
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/ui"
+)
+
+// Phase names recorded in syncResult.Phases. post_sync phases are named
+// "post_sync <hook>".
+const (
+	phaseClone      = "clone"
+	phaseFetch      = "fetch"
+	phaseLsRemote   = "ls-remote"
+	phaseCheckout   = "checkout"
+	phaseSubmodules = "submodules"
+	phaseLFS        = "lfs"
+	phasePostSync   = "post_sync"
+)
+
+// syncPhase is one timed step of a repo's sync.
+type syncPhase struct {
+	Name       string        `json:"name"`
+	DurationMS int64         `json:"duration_ms"`
+	start      time.Time     // for --trace-out
+	lane       int           // worker that ran it, for --trace-out
+	duration   time.Duration // for --timings
+}
+
+// timed runs fn and records its wall time as a phase of the repo's sync,
+// whether or not it fails.
+func (res *syncResult) timed(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	d := time.Since(start)
+	res.Phases = append(res.Phases, syncPhase{Name: name, DurationMS: d.Milliseconds(), start: start, lane: res.lane, duration: d})
+	return err
+}
+
+// hookLabel names a post_sync command for progress and timings.
+func hookLabel(ps manifest.PostSync) string {
+	if ps.Name != "" {
+		return ps.Name
+	}
+	return strings.Join(ps.Cmd, " ")
+}
+
+// printTimings writes every recorded phase, most expensive first, followed
+// by how well the workers were used: the sum of per-repo time divided by the
+// wall time is the average number of busy workers.
+func printTimings(out io.Writer, results []syncResult, wall time.Duration, jobs int) error {
+	type row struct {
+		repo  string
+		phase string
+		d     time.Duration
+	}
+	var rows []row
+	var busy time.Duration
+	for _, res := range results {
+		busy += res.probe + res.duration
+		for _, p := range res.Phases {
+			rows = append(rows, row{res.ID, p.Name, p.duration})
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].d > rows[j].d })
+
+	tbl := ui.NewTable(out, "REPO", "PHASE", "TIME", "SHARE")
+	for _, r := range rows {
+		share := ""
+		if busy > 0 {
+			share = fmt.Sprintf("%.0f%%", 100*float64(r.d)/float64(busy))
+		}
+		tbl.Row(r.repo, r.phase, r.d.Round(time.Millisecond), share)
+	}
+	if err := tbl.Flush(); err != nil {
+		return err
+	}
+	parallelism := 0.0
+	if wall > 0 {
+		parallelism = float64(busy) / float64(wall)
+	}
+	_, _ = fmt.Fprintf(out, "Wall time %s, repo time %s, average %.1f of %d workers busy\n",
+		wall.Round(time.Millisecond), busy.Round(time.Millisecond), parallelism, jobs)
+	return nil
+}
+
+// traceEvent is an entry of the Chrome trace event format, viewable in
+// chrome://tracing or https://ui.perfetto.dev. Times are in microseconds.
+type traceEvent struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat,omitempty"`
+	Ph   string         `json:"ph"`
+	TS   int64          `json:"ts"`
+	Dur  int64          `json:"dur,omitempty"`
+	PID  int            `json:"pid"`
+	TID  int            `json:"tid"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// writeTrace writes a Chrome trace of a sync to path. Each worker of
+// runParallelSync is a thread, with one span per repo and nested spans for
+// its phases. ls-remote phases from probeRemotes come before the repo's span,
+// on the worker that ran them.
+func writeTrace(path string, results []syncResult, start time.Time, jobs int) error {
+	us := func(t time.Time) int64 { return t.Sub(start).Microseconds() }
+
+	events := make([]traceEvent, 0, jobs+len(results))
+	for lane := range jobs {
+		events = append(events, traceEvent{
+			Name: "thread_name", Ph: "M", PID: 1, TID: lane + 1,
+			Args: map[string]any{"name": fmt.Sprintf("worker %d", lane+1)},
+		})
+	}
+	for _, res := range results {
+		if res.start.IsZero() {
+			// Cancelled before a worker picked it up.
+			continue
+		}
+		tid := res.lane + 1
+		args := map[string]any{"action": res.Action}
+		if res.Error != "" {
+			args["error"] = res.Error
+		}
+		events = append(events, traceEvent{
+			Name: res.ID, Cat: "repo", Ph: "X", PID: 1, TID: tid,
+			TS: us(res.start), Dur: res.duration.Microseconds(), Args: args,
+		})
+		for _, p := range res.Phases {
+			events = append(events, traceEvent{
+				Name: p.Name, Cat: "phase", Ph: "X", PID: 1, TID: p.lane + 1,
+				TS: us(p.start), Dur: p.duration.Microseconds(),
+				Args: map[string]any{"repo": res.ID},
+			})
+		}
+	}
+
+	data, err := json.MarshalIndent(map[string]any{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding trace: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing trace: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fbkclanna/agentws/internal/manifest"
+	"github.com/fbkclanna/agentws/internal/testutil"
+)
+
+func TestSync_timingsAndTraceOut(t *testing.T) {
+	wsDir, _ := setupWorkspace(t, 2)
+	editManifest(t, wsDir, func(ws *manifest.Workspace) {
+		ws.Repos[0].PostSync = []manifest.PostSync{{Name: "marker", Cmd: []string{"touch", "marker.txt"}}}
+	})
+	trace := filepath.Join(t.TempDir(), "trace.json")
+
+	out := runAgentws(t, "--root", wsDir, "sync", "--jobs", "2", "--timings", "--trace-out", trace)
+	for _, want := range []string{"PHASE", "clone", "checkout", "post_sync marker", "of 2 workers busy"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("timings output missing %q:\n%s", want, out)
+		}
+	}
+
+	data, err := os.ReadFile(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tr struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(data, &tr); err != nil {
+		t.Fatalf("invalid trace JSON: %v", err)
+	}
+	spans := map[string]int{}
+	threads := 0
+	for _, ev := range tr.TraceEvents {
+		switch ev.Ph {
+		case "M":
+			threads++
+		case "X":
+			if ev.TID < 1 || ev.TID > 2 {
+				t.Errorf("event %s on unexpected thread %d", ev.Name, ev.TID)
+			}
+			spans[ev.Name]++
+		}
+	}
+	if threads != 2 {
+		t.Errorf("thread names = %d, want 2", threads)
+	}
+	for name, want := range map[string]int{"backend": 1, "frontend": 1, "clone": 2, "checkout": 2, "post_sync marker": 1} {
+		if spans[name] != want {
+			t.Errorf("%d %q spans, want %d (all: %v)", spans[name], name, want, spans)
+		}
+	}
+}
+
+func TestSync_jsonIncludesPhases(t *testing.T) {
+	wsDir, bareRepos := setupWorkspace(t, 1)
+	runAgentws(t, "--root", wsDir, "sync")
+	testutil.PushNewCommit(t, bareRepos[0])
+
+	out := runAgentws(t, "--root", wsDir, "sync", "--json")
+	var results []syncResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	var names []string
+	for _, p := range results[0].Phases {
+		names = append(names, p.Name)
+	}
+	if got := strings.Join(names, ","); got != "ls-remote,fetch,checkout" {
+		t.Errorf("phases = %q, want ls-remote,fetch,checkout", got)
+	}
+}
+
+func TestPrintTimings_sortedByCost(t *testing.T) {
+	results := []syncResult{
+		{ID: "a", duration: 3 * time.Second, Phases: []syncPhase{
+			{Name: phaseClone, duration: time.Second},
+			{Name: "post_sync build", duration: 2 * time.Second},
+		}},
+		{ID: "b", duration: 1500 * time.Millisecond, Phases: []syncPhase{
+			{Name: phaseFetch, duration: 1500 * time.Millisecond},
+		}},
+	}
+	var buf bytes.Buffer
+	if err := printTimings(&buf, results, 3*time.Second, 4); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+	for i, want := range []string{"post_sync build", phaseFetch, phaseClone} {
+		if !strings.Contains(lines[i+1], want) {
+			t.Errorf("row %d = %q, want %s", i+1, lines[i+1], want)
+		}
+	}
+	if !strings.Contains(lines[1], "44%") {
+		t.Errorf("share of slowest phase: %q", lines[1])
+	}
+	if want := "Wall time 3s, repo time 4.5s, average 1.5 of 4 workers busy"; lines[4] != want {
+		t.Errorf("footer = %q, want %q", lines[4], want)
+	}
+}
@@ -0,0 +1,157 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entry names inside a bundle archive.
+const (
+	ManifestName = "workspace.yaml"
+	LockName     = "workspace.lock.yaml"
+	reposDir     = "repos"
+	repoSuffix   = ".bundle"
+)
+
+// RepoName returns the archive entry name of the git bundle for repo id.
+func RepoName(id string) string {
+	return path.Join(reposDir, id+repoSuffix)
+}
+
+// Writer writes a bundle archive. The archive only appears at its final path
+// once Close succeeds.
+type Writer struct {
+	path string
+	f    *os.File
+	gz   *gzip.Writer
+	tw   *tar.Writer
+}
+
+// Create starts a new bundle archive at path.
+func Create(path string) (*Writer, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating bundle: %w", err)
+	}
+	gz := gzip.NewWriter(f)
+	return &Writer{path: path, f: f, gz: gz, tw: tar.NewWriter(gz)}, nil
+}
+
+// AddBytes adds a file with the given content.
+func (w *Writer) AddBytes(name string, data []byte) error {
+	if err := w.header(name, int64(len(data))); err != nil {
+		return err
+	}
+	if _, err := w.tw.Write(data); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// AddFile adds the file at src under name.
+func (w *Writer) AddFile(name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := w.header(name, info.Size()); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w.tw, f); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+func (w *Writer) header(name string, size int64) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close finishes the archive and moves it into place.
+func (w *Writer) Close() error {
+	err := errors.Join(w.tw.Close(), w.gz.Close(), w.f.Close())
+	if err == nil {
+		err = os.Rename(w.f.Name(), w.path)
+	}
+	if err != nil {
+		_ = os.Remove(w.f.Name())
+		return fmt.Errorf("writing bundle: %w", err)
+	}
+	return nil
+}
+
+// Abort discards a partially written archive.
+func (w *Writer) Abort() {
+	_ = w.f.Close()
+	_ = os.Remove(w.f.Name())
+}
+
+// Extract unpacks the archive at src into the directory dest.
+func Extract(src, dest string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("opening bundle: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("reading bundle %s: %w", src, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading bundle %s: %w", src, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("bundle entry %q escapes the archive", hdr.Name)
+		}
+		if err := extractFile(tr, filepath.Join(dest, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(r io.Reader, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("extracting %s: %w", filepath.Base(target), err)
+	}
+	return f.Close()
+}
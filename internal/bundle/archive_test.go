@@ -0,0 +1,79 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriterExtract_roundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "backend.bundle")
+	if err := os.WriteFile(src, []byte("bundle data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(dir, "ws.tar.gz")
+	w, err := Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddBytes(ManifestName, []byte("version: 1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddFile(RepoName("backend"), src); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	if err := Extract(archive, dest); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, ManifestName))
+	if err != nil || string(data) != "version: 1\n" {
+		t.Errorf("manifest not extracted: %q, %v", data, err)
+	}
+	data, err = os.ReadFile(filepath.Join(dest, "repos", "backend.bundle"))
+	if err != nil || string(data) != "bundle data" {
+		t.Errorf("repo bundle not extracted: %q, %v", data, err)
+	}
+}
+
+func TestWriter_abortLeavesNothing(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Create(filepath.Join(dir, "ws.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Abort()
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected empty directory, got %v", entries)
+	}
+}
+
+func TestExtract_rejectsTraversal(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "evil.tar.gz")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "../escape.txt", Mode: 0644, Size: 1}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+	_ = gz.Close()
+	_ = f.Close()
+
+	if err := Extract(archive, t.TempDir()); err == nil {
+		t.Fatal("expected error for entry outside the archive root")
+	}
+}
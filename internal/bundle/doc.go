@@ -0,0 +1,4 @@
+// Package bundle reads and writes workspace bundle archives: a gzip-compressed
+// tar file holding the manifest, the lock file and one git bundle per locked
+// repo, used to hand a workspace to machines without network access.
+package bundle
@@ -0,0 +1,319 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fbkclanna/agentws/internal/git"
+)
+
+// EnvDir names the environment variable that overrides the cache directory.
+const EnvDir = "AGENTWS_CACHE_DIR"
+
+const (
+	entrySuffix = ".git"
+	lockSuffix  = ".lock"
+	tmpPrefix   = ".tmp-"
+)
+
+// Lock timing. A lock file whose mtime is older than staleLockAge is assumed
+// to belong to a crashed process; holders refresh it every heartbeat.
+var (
+	staleLockAge  = 2 * time.Minute
+	heartbeat     = 30 * time.Second
+	lockPollDelay = 200 * time.Millisecond
+)
+
+// Cache is a directory of bare clones keyed by remote URL.
+type Cache struct {
+	Dir string
+}
+
+// Entry describes one cached repository.
+type Entry struct {
+	Path string `json:"path"`
+	URL  string `json:"url"`
+	Size int64  `json:"size_bytes"`
+}
+
+// New returns a cache rooted at dir.
+func New(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// Default returns the cache at $AGENTWS_CACHE_DIR, or at
+// <user cache dir>/agentws/objects if the variable is unset.
+func Default() (*Cache, error) {
+	if dir := os.Getenv(EnvDir); dir != "" {
+		return New(dir), nil
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("locating user cache directory: %w", err)
+	}
+	return New(filepath.Join(base, "agentws", "objects")), nil
+}
+
+// Key returns the cache key for a remote URL. URLs that differ only by a
+// trailing slash or ".git" suffix share a key.
+func Key(url string) string {
+	u := strings.TrimSuffix(strings.TrimRight(url, "/"), ".git")
+	sum := sha256.Sum256([]byte(u))
+	return hex.EncodeToString(sum[:12])
+}
+
+// Path returns the location of the bare clone for url.
+func (c *Cache) Path(url string) string {
+	return filepath.Join(c.Dir, Key(url)+entrySuffix)
+}
+
+// Reference returns the cache path for url if it has been populated, or ""
+// otherwise. The result is suitable for git.CloneOpts.Reference.
+func (c *Cache) Reference(url string) string {
+	if c == nil {
+		return ""
+	}
+	path := c.Path(url)
+	if _, err := os.Stat(filepath.Join(path, "HEAD")); err != nil {
+		return ""
+	}
+	return path
+}
+
+// Update creates the cache entry for url, or fetches into it if it exists.
+// Workspace clones borrow objects from the entry, so it is configured never
+// to drop them (see git.ProtectObjects and git.FetchBare). Concurrent
+// updates of the same entry (also from other processes) are serialized; a
+// new entry only becomes visible once its clone is complete.
+func (c *Cache) Update(ctx context.Context, url string) (created bool, err error) {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return false, fmt.Errorf("creating cache directory: %w", err)
+	}
+	path := c.Path(url)
+	unlock, err := acquireLock(ctx, path+lockSuffix)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if c.Reference(url) != "" {
+		// Also protects entries created before protection was set up.
+		if err := git.ProtectObjects(path); err != nil {
+			return false, fmt.Errorf("configuring cache for %s: %w", url, err)
+		}
+		if err := git.FetchBare(ctx, path); err != nil {
+			return false, fmt.Errorf("updating cache for %s: %w", url, err)
+		}
+		return false, nil
+	}
+
+	tmp, err := os.MkdirTemp(c.Dir, tmpPrefix)
+	if err != nil {
+		return false, fmt.Errorf("creating cache directory: %w", err)
+	}
+	if err := git.CloneBare(ctx, url, tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return false, err
+	}
+	if err := git.ProtectObjects(tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return false, fmt.Errorf("configuring cache for %s: %w", url, err)
+	}
+	_ = os.RemoveAll(path) // leftover of an interrupted run without HEAD
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.RemoveAll(tmp)
+		return false, fmt.Errorf("installing cache entry: %w", err)
+	}
+	return true, nil
+}
+
+// Entries lists the cached repositories sorted by path.
+func (c *Cache) Entries() ([]Entry, error) {
+	dirEntries, err := os.ReadDir(c.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading cache directory: %w", err)
+	}
+	var entries []Entry
+	for _, de := range dirEntries {
+		if !de.IsDir() || !strings.HasSuffix(de.Name(), entrySuffix) {
+			continue
+		}
+		path := filepath.Join(c.Dir, de.Name())
+		url, _ := git.RemoteURL(path)
+		size, err := dirSize(path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{Path: path, URL: url, Size: size})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// GC repacks every cache entry and removes temporary directories left behind
+// by interrupted updates. Unreachable objects are never pruned, since
+// workspace clones may still borrow them.
+func (c *Cache) GC(ctx context.Context) ([]Entry, error) {
+	if err := c.removeStaleTemp(); err != nil {
+		return nil, err
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if err := gcEntry(ctx, e.Path); err != nil {
+			return nil, err
+		}
+	}
+	return c.Entries()
+}
+
+func gcEntry(ctx context.Context, path string) error {
+	unlock, err := acquireLock(ctx, path+lockSuffix)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := git.GC(ctx, path); err != nil {
+		return fmt.Errorf("gc %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// removeStaleTemp deletes temporary clone directories that are too old to
+// belong to a running update.
+func (c *Cache) removeStaleTemp() error {
+	dirEntries, err := os.ReadDir(c.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading cache directory: %w", err)
+	}
+	for _, de := range dirEntries {
+		if !strings.HasPrefix(de.Name(), tmpPrefix) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil || time.Since(info.ModTime()) < staleLockAge {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.Dir, de.Name())); err != nil {
+			return fmt.Errorf("removing %s: %w", de.Name(), err)
+		}
+	}
+	return nil
+}
+
+// acquireLock creates path exclusively, waiting while another process holds
+// it. Locks not refreshed for staleLockAge are broken. The returned function
+// releases the lock.
+func acquireLock(ctx context.Context, path string) (func(), error) {
+	token := fmt.Sprintf("%d-%d", os.Getpid(), rand.Int64())
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, _ = f.WriteString(token)
+			_ = f.Close()
+			return holdLock(path, token), nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("creating lock %s: %w", path, err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			breakStaleLock(path, token)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for lock %s: %w", path, ctx.Err())
+		case <-time.After(lockPollDelay):
+		}
+	}
+}
+
+// breakStaleLock removes the lock at path, which the caller found stale. The
+// lock is first renamed to a name unique to the caller, so that of several
+// processes that saw the same stale lock only one removes it. If the renamed
+// lock turns out to be fresh, another process had already broken the stale
+// lock and taken a new one in the meantime, and it is put back.
+func breakStaleLock(path, token string) {
+	moved := path + ".stale-" + token
+	if err := os.Rename(path, moved); err != nil {
+		return
+	}
+	if info, err := os.Stat(moved); err == nil && time.Since(info.ModTime()) <= staleLockAge {
+		_ = os.Link(moved, path)
+	}
+	_ = os.Remove(moved)
+}
+
+// holdLock keeps the lock at path fresh until the returned release function
+// is called or the lock no longer holds token. Release only removes the lock
+// if it still holds token. Either way, a holder whose lock was broken leaves
+// its successor's lock alone.
+func holdLock(path, token string) func() {
+	done := make(chan struct{})
+	t := time.NewTicker(heartbeat)
+	go func() {
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-t.C:
+				if !ownsLock(path, token) {
+					return
+				}
+				_ = os.Chtimes(path, now, now)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		if ownsLock(path, token) {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+// ownsLock reports whether the lock at path still holds token.
+func ownsLock(path, token string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && string(data) == token
+}
+
+func dirSize(root string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("measuring %s: %w", filepath.Base(root), err)
+	}
+	return size, nil
+}
@@ -0,0 +1,327 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fbkclanna/agentws/internal/git"
+	"github.com/fbkclanna/agentws/internal/testutil"
+)
+
+func TestKey_normalizesURL(t *testing.T) {
+	a := Key("https://example.com/org/repo.git")
+	if b := Key("https://example.com/org/repo"); a != b {
+		t.Errorf("keys differ for .git suffix: %s vs %s", a, b)
+	}
+	if b := Key("https://example.com/org/repo/"); a != b {
+		t.Errorf("keys differ for trailing slash: %s vs %s", a, b)
+	}
+	if b := Key("https://example.com/org/other"); a == b {
+		t.Error("different URLs should have different keys")
+	}
+}
+
+func TestDefault_envOverride(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(EnvDir, dir)
+	c, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Dir != dir {
+		t.Errorf("Dir = %s, want %s", c.Dir, dir)
+	}
+}
+
+func TestUpdate_createsThenFetches(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	c := New(t.TempDir())
+
+	if ref := c.Reference(bare); ref != "" {
+		t.Fatalf("empty cache should have no reference, got %s", ref)
+	}
+
+	created, err := c.Update(context.Background(), bare)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if !created {
+		t.Error("first Update should create the entry")
+	}
+	if c.Reference(bare) != c.Path(bare) {
+		t.Error("Reference should point at the populated entry")
+	}
+
+	testutil.PushNewCommit(t, bare)
+	created, err = c.Update(context.Background(), bare)
+	if err != nil {
+		t.Fatalf("second Update failed: %v", err)
+	}
+	if created {
+		t.Error("second Update should fetch, not create")
+	}
+
+	head, err := git.HeadCommitFull(bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !git.HasCommit(c.Path(bare), head) {
+		t.Error("cache entry should contain the new upstream commit")
+	}
+}
+
+func TestUpdate_concurrent(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	c := New(t.TempDir())
+
+	const n = 4
+	var wg sync.WaitGroup
+	created := make([]bool, n)
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			created[i], errs[i] = c.Update(context.Background(), bare)
+		}(i)
+	}
+	wg.Wait()
+
+	count := 0
+	for i := range n {
+		if errs[i] != nil {
+			t.Errorf("Update %d failed: %v", i, errs[i])
+		}
+		if created[i] {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected exactly one Update to create the entry, got %d", count)
+	}
+	if _, err := os.Stat(c.Path(bare) + lockSuffix); !os.IsNotExist(err) {
+		t.Error("lock file should be released")
+	}
+}
+
+func TestCloneWithReference(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	c := New(t.TempDir())
+	if _, err := c.Update(context.Background(), bare); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "clone")
+	if err := git.Clone(context.Background(), bare, dest, git.CloneOpts{Reference: c.Reference(bare)}); err != nil {
+		t.Fatalf("clone failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, ".git", "objects", "info", "alternates"))
+	if err != nil {
+		t.Fatalf("clone should use alternates: %v", err)
+	}
+	if len(data) == 0 {
+		t.Error("alternates file is empty")
+	}
+}
+
+func TestUpdate_keepsBorrowedObjectsAfterForcePush(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	testutil.PushNewCommit(t, bare)
+	c := New(t.TempDir())
+	if _, err := c.Update(context.Background(), bare); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), "clone")
+	if err := git.Clone(context.Background(), bare, dest, git.CloneOpts{Reference: c.Reference(bare)}); err != nil {
+		t.Fatal(err)
+	}
+	borrowed, err := git.HeadCommitFull(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite main upstream so the borrowed commit becomes unreachable
+	// there, update the cache and let git collect garbage.
+	work := filepath.Join(t.TempDir(), "work")
+	gitRun(t, "", "clone", "--quiet", bare, work)
+	gitRun(t, work, "reset", "--quiet", "--hard", "HEAD~1")
+	gitRun(t, work, "-c", "user.name=t", "-c", "user.email=t@t", "commit", "--quiet", "--allow-empty", "-m", "rewritten")
+	gitRun(t, work, "push", "--quiet", "--force", "origin", "HEAD:main")
+	if _, err := c.Update(context.Background(), bare); err != nil {
+		t.Fatal(err)
+	}
+	if got := gitRun(t, c.Path(bare), "config", "gc.auto"); got != "0" {
+		t.Errorf("gc.auto = %q, want 0", got)
+	}
+	gitRun(t, c.Path(bare), "gc", "--quiet", "--prune=now")
+
+	if !git.HasCommit(c.Path(bare), borrowed) {
+		t.Error("cache lost the commit that was force-pushed away")
+	}
+	gitRun(t, dest, "fsck", "--connectivity-only")
+}
+
+// gitRun runs git in dir (or the current directory if dir is empty) and
+// returns its trimmed output.
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestEntriesAndGC(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	c := New(t.TempDir())
+	if _, err := c.Update(context.Background(), bare); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := filepath.Join(c.Dir, tmpPrefix+"stale")
+	if err := os.Mkdir(stale, 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := c.GC(context.Background())
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].URL != bare || entries[0].Size == 0 {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale temporary directory should be removed")
+	}
+}
+
+func TestAcquireLock_breaksStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.lock")
+	if err := os.WriteFile(path, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	unlock, err := acquireLock(ctx, path)
+	if err != nil {
+		t.Fatalf("stale lock should be broken: %v", err)
+	}
+	unlock()
+}
+
+func TestBreakStaleLock_keepsFreshLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.lock")
+	if err := os.WriteFile(path, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// A breaks the stale lock and takes a fresh one; B, which saw the same
+	// stale lock earlier, only tries to break it afterwards.
+	unlock, err := acquireLock(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	held, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	breakStaleLock(path, "b")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("fresh lock was removed: %v", err)
+	}
+	if string(data) != string(held) {
+		t.Errorf("lock content = %q, want %q", data, held)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := acquireLock(ctx, path); err == nil {
+		t.Fatal("lock should still be held")
+	}
+}
+
+func TestAcquireLock_releaseKeepsSuccessorLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.lock")
+	unlock, err := acquireLock(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another process broke the lock and took over.
+	if err := os.WriteFile(path, []byte("successor"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if data, err := os.ReadFile(path); err != nil || string(data) != "successor" {
+		t.Errorf("release removed the successor's lock (content %q, err %v)", data, err)
+	}
+}
+
+func TestAcquireLock_heartbeatStopsAfterTakeover(t *testing.T) {
+	orig := heartbeat
+	heartbeat = 5 * time.Millisecond
+	defer func() { heartbeat = orig }()
+
+	path := filepath.Join(t.TempDir(), "x.lock")
+	unlock, err := acquireLock(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	// Another process broke the lock and took over, then crashed.
+	if err := os.WriteFile(path, []byte("successor"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Error("heartbeat refreshed a lock it no longer holds")
+	}
+}
+
+func TestAcquireLock_waitsForHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.lock")
+	unlock, err := acquireLock(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := acquireLock(ctx, path); err == nil {
+		t.Fatal("second acquire should block until the context expires")
+	}
+}
@@ -0,0 +1,4 @@
+// Package cache manages the shared object cache: one bare clone per remote
+// URL that workspace clones borrow objects from via git alternates, so that
+// several workspaces on a machine do not each store a full copy of a repo.
+package cache
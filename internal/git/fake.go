@@ -0,0 +1,72 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// FakeRunner is a Runner for unit tests. It records every invocation and
+// answers with responses registered via On; unmatched invocations succeed
+// with empty output.
+type FakeRunner struct {
+	mu        sync.Mutex
+	calls     []Cmd
+	responses []fakeResponse
+}
+
+type fakeResponse struct {
+	prefix string
+	stdout string
+	err    error
+}
+
+// On registers the stdout and error returned for invocations whose arguments,
+// joined by spaces, start with prefix. Later registrations take precedence.
+func (f *FakeRunner) On(prefix, stdout string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{prefix: prefix, stdout: stdout, err: err})
+}
+
+// Run records cmd and writes the matching response to cmd.Stdout.
+func (f *FakeRunner) Run(_ context.Context, cmd Cmd) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, cmd)
+	line := strings.Join(cmd.Args, " ")
+	for i := len(f.responses) - 1; i >= 0; i-- {
+		resp := f.responses[i]
+		if !strings.HasPrefix(line, resp.prefix) {
+			continue
+		}
+		if cmd.Stdout != nil {
+			_, _ = io.WriteString(cmd.Stdout, resp.stdout)
+		}
+		return resp.err
+	}
+	return nil
+}
+
+// Calls returns the recorded invocations as "git ..." command lines.
+func (f *FakeRunner) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lines := make([]string, len(f.calls))
+	for i, c := range f.calls {
+		lines[i] = c.String()
+	}
+	return lines
+}
+
+// ExitStatus returns an error that callers treat like git exiting with code.
+func ExitStatus(code int) error {
+	return exitStatus(code)
+}
+
+type exitStatus int
+
+func (e exitStatus) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e exitStatus) ExitCode() int { return int(e) }
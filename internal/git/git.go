@@ -1,11 +1,13 @@
 package git
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -14,10 +16,13 @@ type CloneOpts struct {
 	Depth        *int
 	PartialClone bool
 	Sparse       []string
+	NoCone       bool   // treat Sparse as patterns instead of cone-mode directories
+	Reference    string // borrow objects from this local repo (--reference-if-able)
 }
 
 // Clone clones a repository to dest with the given options.
-func Clone(url, dest string, opts CloneOpts) error {
+// The clone is aborted when ctx is cancelled.
+func Clone(ctx context.Context, url, dest string, opts CloneOpts) error {
 	args := []string{"clone"}
 
 	if opts.Depth != nil && *opts.Depth > 0 {
@@ -26,21 +31,25 @@ func Clone(url, dest string, opts CloneOpts) error {
 	if opts.PartialClone {
 		args = append(args, "--filter=blob:none")
 	}
-	if len(opts.Sparse) > 0 {
+	sparse := len(opts.Sparse) > 0
+	if sparse {
 		args = append(args, "--no-checkout")
 	}
+	if opts.Reference != "" {
+		args = append(args, "--reference-if-able", opts.Reference)
+	}
 
 	args = append(args, url, dest)
 
-	if err := run(".", args...); err != nil {
+	if err := run(ctx, ".", args...); err != nil {
 		return fmt.Errorf("cloning %s: %w", url, err)
 	}
 
-	if len(opts.Sparse) > 0 {
-		if err := SparseCheckoutSet(dest, opts.Sparse); err != nil {
+	if sparse {
+		if err := SparseCheckoutSet(dest, opts.Sparse, !opts.NoCone); err != nil {
 			return err
 		}
-		if err := run(dest, "checkout"); err != nil {
+		if err := run(ctx, dest, "checkout"); err != nil {
 			return fmt.Errorf("checkout after sparse setup: %w", err)
 		}
 	}
@@ -48,19 +57,211 @@ func Clone(url, dest string, opts CloneOpts) error {
 	return nil
 }
 
-// Fetch runs git fetch in the given repo directory.
-func Fetch(repoDir string) error {
-	return run(repoDir, "fetch", "--prune")
+// CloneBare creates a bare clone of url at dest without printing progress.
+func CloneBare(ctx context.Context, url, dest string) error {
+	if err := run(ctx, ".", "clone", "--bare", "--quiet", url, dest); err != nil {
+		return fmt.Errorf("cloning %s: %w", url, err)
+	}
+	return nil
+}
+
+// ProtectObjects configures a repository whose objects are borrowed by other
+// clones (through alternates) so that git never deletes them: automatic gc
+// is disabled and unreachable objects are never pruned.
+func ProtectObjects(dir string) error {
+	for _, kv := range [][2]string{{"gc.auto", "0"}, {"gc.pruneExpire", "never"}} {
+		if err := run(context.Background(), dir, "config", kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchBare updates all branches and tags of a bare clone from origin.
+// Refs deleted upstream are kept, and tips replaced by a force-push are kept
+// under refs/keep/, so that objects borrowed by other clones stay reachable.
+func FetchBare(ctx context.Context, dir string) error {
+	before, err := output(ctx, dir, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads", "refs/tags")
+	if err != nil {
+		return err
+	}
+	if err := run(ctx, dir, "fetch", "--quiet", "origin",
+		"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"); err != nil {
+		return err
+	}
+	after, err := output(ctx, dir, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads", "refs/tags")
+	if err != nil {
+		return err
+	}
+
+	now := parseRefList(after, " ")
+	for ref, old := range parseRefList(before, " ") {
+		cur := now[ref]
+		if cur == old || run(ctx, dir, "merge-base", "--is-ancestor", old, cur) == nil {
+			continue
+		}
+		if err := run(ctx, dir, "update-ref", "refs/keep/"+old, old); err != nil {
+			return fmt.Errorf("keeping old tip of %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// GC repacks the repository without pruning unreachable objects.
+func GC(ctx context.Context, dir string) error {
+	return run(ctx, dir, "gc", "--quiet", "--prune=never")
+}
+
+// RemoteURL returns the URL of the origin remote.
+func RemoteURL(repoDir string) (string, error) {
+	out, err := output(context.Background(), repoDir, "config", "--get", "remote.origin.url")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// SetRemoteURL points the origin remote at url.
+func SetRemoteURL(repoDir, url string) error {
+	return run(context.Background(), repoDir, "remote", "set-url", "origin", url)
+}
+
+// SharesHistory fetches the default branch of url and reports whether it has
+// a common ancestor with HEAD. In a shallow clone the common ancestor may be
+// outside the local history, in which case false is returned.
+func SharesHistory(ctx context.Context, repoDir, url string) (bool, error) {
+	if err := run(ctx, repoDir, "fetch", "--no-tags", url, "HEAD"); err != nil {
+		return false, err
+	}
+	err := run(ctx, repoDir, "merge-base", "HEAD", "FETCH_HEAD")
+	if err != nil {
+		if isExitError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// bundleRef is the temporary ref under which CreateBundle exports a commit.
+const bundleRef = "refs/agentws/bundle"
+
+// CreateBundle writes a git bundle to dest containing commit and its history.
+func CreateBundle(ctx context.Context, repoDir, commit, dest string) error {
+	if err := run(ctx, repoDir, "update-ref", bundleRef, commit); err != nil {
+		return err
+	}
+	defer func() { _ = run(context.Background(), repoDir, "update-ref", "-d", bundleRef) }()
+	return run(ctx, repoDir, "bundle", "create", "--quiet", dest, bundleRef)
+}
+
+// CloneBundle creates a repository at dest from a bundle written by
+// CreateBundle and checks out branch at the bundled commit, or the commit
+// itself with a detached HEAD if branch is empty (for tag and commit refs).
+// If url is not empty it becomes the origin remote, with origin/<branch> set
+// as upstream, so later fetches go to the canonical location.
+func CloneBundle(ctx context.Context, bundle, dest, branch, url string) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	steps := [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", bundle, bundleRef},
+	}
+	if branch != "" {
+		steps = append(steps, []string{"checkout", "--quiet", "-B", branch, "FETCH_HEAD"})
+	} else {
+		steps = append(steps, []string{"checkout", "--quiet", "--detach", "FETCH_HEAD"})
+	}
+	if url != "" {
+		steps = append(steps, []string{"remote", "add", "origin", url})
+	}
+	if url != "" && branch != "" {
+		steps = append(steps,
+			[]string{"update-ref", "refs/remotes/origin/" + branch, "FETCH_HEAD"},
+			[]string{"branch", "--quiet", "--set-upstream-to=origin/" + branch, branch},
+		)
+	}
+	for _, args := range steps {
+		if err := run(ctx, dest, args...); err != nil {
+			return fmt.Errorf("restoring from bundle: %w", err)
+		}
+	}
+	return nil
+}
+
+// Fetch runs git fetch in the given repo directory and, if it succeeds,
+// records the time for LastFetch.
+func Fetch(ctx context.Context, repoDir string) error {
+	if err := run(ctx, repoDir, "fetch", "--prune"); err != nil {
+		return err
+	}
+	// Failing to write the stamp only makes the next --max-age sync fetch
+	// again, so it does not fail the fetch.
+	if path, err := gitPath(repoDir, fetchStamp); err == nil {
+		_ = os.WriteFile(path, nil, 0644)
+	}
+	return nil
 }
 
 // Checkout checks out the given ref.
 func Checkout(repoDir, ref string) error {
-	return run(repoDir, "checkout", ref)
+	return run(context.Background(), repoDir, "checkout", ref)
+}
+
+// CheckoutDetached checks out rev (a tag or commit) with a detached HEAD.
+func CheckoutDetached(repoDir, rev string) error {
+	return run(context.Background(), repoDir, "checkout", "--detach", rev)
+}
+
+// ResolveCommit returns the full SHA of the commit rev points to.
+func ResolveCommit(repoDir, rev string) (string, error) {
+	out, err := output(context.Background(), repoDir, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// HasCommit returns true if the given commit object exists in the local repository.
+func HasCommit(repoDir, sha string) bool {
+	return run(context.Background(), repoDir, "cat-file", "-e", sha+"^{commit}") == nil
+}
+
+// IsShallow returns true if the repository is a shallow clone.
+func IsShallow(repoDir string) bool {
+	out, err := output(context.Background(), repoDir, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(out) == "true"
+}
+
+// FetchCommit fetches a single commit by SHA from origin. When depth > 0 the
+// fetch is limited to that many commits of history. The server must allow
+// fetching reachable commits by SHA (the default with protocol v2).
+func FetchCommit(ctx context.Context, repoDir, sha string, depth int) error {
+	args := []string{"fetch", "--no-write-fetch-head"}
+	if depth > 0 {
+		args = append(args, "--depth", fmt.Sprintf("%d", depth))
+	}
+	args = append(args, "origin", sha)
+	return run(ctx, repoDir, args...)
+}
+
+// Deepen extends the history of a shallow clone by n commits.
+func Deepen(ctx context.Context, repoDir string, n int) error {
+	return run(ctx, repoDir, "fetch", fmt.Sprintf("--deepen=%d", n), "origin")
+}
+
+// Unshallow converts a shallow clone into a full clone.
+func Unshallow(ctx context.Context, repoDir string) error {
+	return run(ctx, repoDir, "fetch", "--unshallow", "origin")
 }
 
 // CurrentBranch returns the current branch name, or empty string if detached.
 func CurrentBranch(repoDir string) (string, error) {
-	out, err := output(repoDir, "symbolic-ref", "--short", "HEAD")
+	out, err := output(context.Background(), repoDir, "symbolic-ref", "--short", "HEAD")
 	if err != nil {
 		// Detached HEAD: symbolic-ref fails.
 		return "", nil
@@ -70,7 +271,7 @@ func CurrentBranch(repoDir string) (string, error) {
 
 // HeadCommit returns the short SHA of HEAD.
 func HeadCommit(repoDir string) (string, error) {
-	out, err := output(repoDir, "rev-parse", "--short", "HEAD")
+	out, err := output(context.Background(), repoDir, "rev-parse", "--short", "HEAD")
 	if err != nil {
 		return "", err
 	}
@@ -79,7 +280,7 @@ func HeadCommit(repoDir string) (string, error) {
 
 // HeadCommitFull returns the full SHA of HEAD.
 func HeadCommitFull(repoDir string) (string, error) {
-	out, err := output(repoDir, "rev-parse", "HEAD")
+	out, err := output(context.Background(), repoDir, "rev-parse", "HEAD")
 	if err != nil {
 		return "", err
 	}
@@ -88,16 +289,86 @@ func HeadCommitFull(repoDir string) (string, error) {
 
 // IsDirty returns true if the working tree has uncommitted changes.
 func IsDirty(repoDir string) (bool, error) {
-	out, err := output(repoDir, "status", "--porcelain")
+	st, err := Status(repoDir)
 	if err != nil {
 		return false, err
 	}
-	return strings.TrimSpace(out) != "", nil
+	return st.Dirty(), nil
+}
+
+// Upstream returns the upstream of the current branch (e.g. "origin/main"),
+// or an empty string if HEAD is detached or has no upstream configured.
+func Upstream(repoDir string) string {
+	out, err := output(context.Background(), repoDir, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// AheadBehind returns how many commits HEAD is ahead of and behind ref.
+func AheadBehind(repoDir, ref string) (ahead, behind int, err error) {
+	out, err := output(context.Background(), repoDir, "rev-list", "--left-right", "--count", "HEAD..."+ref)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := fmt.Sscanf(strings.TrimSpace(out), "%d %d", &ahead, &behind); err != nil {
+		return 0, 0, fmt.Errorf("parsing rev-list output %q: %w", out, err)
+	}
+	return ahead, behind, nil
+}
+
+// CountCommits returns the number of commits reachable from to but not from
+// from.
+func CountCommits(repoDir, from, to string) (int, error) {
+	out, err := output(context.Background(), repoDir, "rev-list", "--count", from+".."+to)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("parsing rev-list output %q: %w", out, err)
+	}
+	return n, nil
+}
+
+// CommitSubject returns the subject line of the commit rev.
+func CommitSubject(repoDir, rev string) (string, error) {
+	out, err := output(context.Background(), repoDir, "log", "-1", "--format=%s", rev)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// CommitTime returns the committer date of rev in strict ISO 8601 format.
+func CommitTime(repoDir, rev string) (string, error) {
+	out, err := output(context.Background(), repoDir, "log", "-1", "--format=%cI", rev)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// MergeFFOnly fast-forwards the current branch to ref. It fails without
+// changing anything if a fast-forward is not possible.
+func MergeFFOnly(repoDir, ref string) error {
+	return run(context.Background(), repoDir, "merge", "--ff-only", ref)
+}
+
+// Rebase rebases the current branch onto ref. On conflict the rebase is
+// aborted and the branch is left unchanged.
+func Rebase(repoDir, ref string) error {
+	if err := run(context.Background(), repoDir, "rebase", ref); err != nil {
+		_ = run(context.Background(), repoDir, "rebase", "--abort")
+		return err
+	}
+	return nil
 }
 
 // BranchExists checks if a local branch exists.
 func BranchExists(repoDir, branch string) (bool, error) {
-	err := run(repoDir, "show-ref", "--verify", "--quiet", "refs/heads/"+branch)
+	err := run(context.Background(), repoDir, "show-ref", "--verify", "--quiet", "refs/heads/"+branch)
 	if err != nil {
 		if isExitError(err) {
 			return false, nil
@@ -107,9 +378,32 @@ func BranchExists(repoDir, branch string) (bool, error) {
 	return true, nil
 }
 
+// TagExists checks if a tag exists locally.
+func TagExists(repoDir, tag string) (bool, error) {
+	err := run(context.Background(), repoDir, "show-ref", "--verify", "--quiet", "refs/tags/"+tag)
+	if err != nil {
+		if isExitError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// FetchTag fetches a single tag from origin. When depth > 0 the fetch is
+// limited to that many commits of history.
+func FetchTag(ctx context.Context, repoDir, tag string, depth int) error {
+	args := []string{"fetch", "--no-write-fetch-head", "--no-tags"}
+	if depth > 0 {
+		args = append(args, "--depth", fmt.Sprintf("%d", depth))
+	}
+	args = append(args, "origin", "+refs/tags/"+tag+":refs/tags/"+tag)
+	return run(ctx, repoDir, args...)
+}
+
 // RemoteBranchExists checks if a remote branch exists (after fetch).
 func RemoteBranchExists(repoDir, branch string) (bool, error) {
-	err := run(repoDir, "show-ref", "--verify", "--quiet", "refs/remotes/origin/"+branch)
+	err := run(context.Background(), repoDir, "show-ref", "--verify", "--quiet", "refs/remotes/origin/"+branch)
 	if err != nil {
 		if isExitError(err) {
 			return false, nil
@@ -119,39 +413,139 @@ func RemoteBranchExists(repoDir, branch string) (bool, error) {
 	return true, nil
 }
 
+// UnpushedBranches returns local branches that have commits not reachable
+// from any remote-tracking ref. In a repo without remotes every branch with
+// commits is reported.
+func UnpushedBranches(repoDir string) ([]string, error) {
+	out, err := output(context.Background(), repoDir, "for-each-ref", "--format=%(refname:short)", "refs/heads")
+	if err != nil {
+		return nil, err
+	}
+	var branches []string
+	for _, b := range strings.Fields(out) {
+		count, err := output(context.Background(), repoDir, "rev-list", "--count", "refs/heads/"+b, "--not", "--remotes")
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(count) != "0" {
+			branches = append(branches, b)
+		}
+	}
+	return branches, nil
+}
+
 // CreateBranch creates a new branch from the given ref.
 // --no-track prevents automatic upstream tracking when 'from' is a remote
 // tracking ref (e.g. origin/main), which would cause git push to target the
 // base branch instead of the new branch.
 func CreateBranch(repoDir, branch, from string) error {
-	return run(repoDir, "checkout", "-b", branch, "--no-track", from)
+	return run(context.Background(), repoDir, "checkout", "-b", branch, "--no-track", from)
 }
 
 // CreateTrackingBranch creates a local tracking branch for origin/<branch>.
 func CreateTrackingBranch(repoDir, branch string) error {
-	return run(repoDir, "checkout", "-b", branch, "--track", "origin/"+branch)
+	return run(context.Background(), repoDir, "checkout", "-b", branch, "--track", "origin/"+branch)
 }
 
 // Stash stashes uncommitted changes.
 func Stash(repoDir string) error {
-	return run(repoDir, "stash")
+	return run(context.Background(), repoDir, "stash")
 }
 
 // ResetHard resets the working tree to the given ref.
 func ResetHard(repoDir, ref string) error {
-	return run(repoDir, "reset", "--hard", ref)
+	return run(context.Background(), repoDir, "reset", "--hard", ref)
+}
+
+// SparseCheckoutSet configures sparse-checkout with the given paths, in cone
+// mode (directories) or non-cone mode (gitignore-style patterns).
+func SparseCheckoutSet(repoDir string, paths []string, cone bool) error {
+	mode := "--cone"
+	if !cone {
+		mode = "--no-cone"
+	}
+	args := append([]string{"sparse-checkout", "set", mode, "--"}, paths...)
+	return run(context.Background(), repoDir, args...)
+}
+
+// SparseCheckoutDisable turns sparse-checkout off and restores the full tree.
+func SparseCheckoutDisable(repoDir string) error {
+	return run(context.Background(), repoDir, "sparse-checkout", "disable")
+}
+
+// SparseState describes the sparse-checkout configuration of a repository.
+type SparseState struct {
+	Enabled bool
+	Cone    bool
+	Paths   []string // directories in cone mode, patterns otherwise
+}
+
+// SparseCheckout reads the sparse-checkout configuration of the repository.
+func SparseCheckout(repoDir string) (SparseState, error) {
+	var st SparseState
+	if !configBool(repoDir, "core.sparseCheckout") {
+		return st, nil
+	}
+	st.Enabled = true
+	st.Cone = configBool(repoDir, "core.sparseCheckoutCone")
+	out, err := output(context.Background(), repoDir, "sparse-checkout", "list")
+	if err != nil {
+		return st, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			st.Paths = append(st.Paths, line)
+		}
+	}
+	return st, nil
+}
+
+// PartialCloneFilter returns the partial clone filter of origin (e.g.
+// "blob:none"), or "" if the repository is not a partial clone.
+func PartialCloneFilter(repoDir string) string {
+	out, err := output(context.Background(), repoDir, "config", "--get", "remote.origin.partialclonefilter")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
 }
 
-// SparseCheckoutSet configures sparse-checkout with the given paths.
-func SparseCheckoutSet(repoDir string, paths []string) error {
-	args := append([]string{"sparse-checkout", "set", "--"}, paths...)
-	return run(repoDir, args...)
+// EnablePartialClone converts the repository into a blobless partial clone;
+// later fetches from origin skip blobs until they are needed.
+func EnablePartialClone(ctx context.Context, repoDir string) error {
+	return run(ctx, repoDir, "fetch", "--quiet", "--filter=blob:none", "origin")
+}
+
+// HistoryDepth returns the number of commits reachable from HEAD, which for
+// a shallow clone is its effective depth.
+func HistoryDepth(repoDir string) (int, error) {
+	out, err := output(context.Background(), repoDir, "rev-list", "--count", "HEAD")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(out))
+}
+
+// configBool reports whether a boolean git config key is set to true.
+func configBool(repoDir, key string) bool {
+	out, err := output(context.Background(), repoDir, "config", "--type=bool", "--get", key)
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// OriginHead returns the branch origin/HEAD points to in a clone (set by
+// git clone), or an empty string if it is not set.
+func OriginHead(repoDir string) string {
+	out, err := output(context.Background(), repoDir, "symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimSpace(out), "origin/")
 }
 
 // DefaultBranch detects the default branch of a remote repository using
 // git ls-remote --symref. Returns an error if the branch cannot be detected.
 func DefaultBranch(url string) (string, error) {
-	out, err := output(".", "ls-remote", "--symref", url, "HEAD")
+	out, err := output(context.Background(), ".", "ls-remote", "--symref", url, "HEAD")
 	if err != nil {
 		return "", fmt.Errorf("ls-remote %s: %w", url, err)
 	}
@@ -166,9 +560,74 @@ func DefaultBranch(url string) (string, error) {
 	return "", fmt.Errorf("default branch not found for %s", url)
 }
 
+// SubmoduleUpdate syncs submodule URLs and initializes/updates all submodules
+// recursively. With shallow, submodules are cloned with depth 1.
+func SubmoduleUpdate(ctx context.Context, repoDir string, shallow bool) error {
+	if err := run(ctx, repoDir, "submodule", "sync", "--quiet", "--recursive"); err != nil {
+		return err
+	}
+	args := []string{"submodule", "update", "--quiet", "--init", "--recursive"}
+	if shallow {
+		args = append(args, "--depth", "1")
+	}
+	return run(ctx, repoDir, args...)
+}
+
+// Submodule describes a submodule as reported by git submodule status.
+type Submodule struct {
+	Path        string
+	Commit      string
+	Initialized bool
+	OutOfDate   bool // checked-out commit differs from the one recorded in the superproject
+	Conflict    bool
+}
+
+// Submodules lists the submodules of the repository recursively.
+func Submodules(repoDir string) ([]Submodule, error) {
+	out, err := output(context.Background(), repoDir, "submodule", "status", "--recursive")
+	if err != nil {
+		return nil, err
+	}
+	var subs []Submodule
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		commit, path, ok := strings.Cut(line[1:], " ")
+		if !ok {
+			continue
+		}
+		// Paths may contain spaces, so everything up to the " (describe)"
+		// suffix that git appends for checked-out submodules is the path.
+		if line[0] != '-' && strings.HasSuffix(path, ")") {
+			if i := strings.LastIndex(path, " ("); i >= 0 {
+				path = path[:i]
+			}
+		}
+		subs = append(subs, Submodule{
+			Path:        path,
+			Commit:      commit,
+			Initialized: line[0] != '-',
+			OutOfDate:   line[0] == '+',
+			Conflict:    line[0] == 'U',
+		})
+	}
+	return subs, nil
+}
+
+// IsLFSInstalled returns true if the git-lfs extension is available.
+func IsLFSInstalled() bool {
+	return run(context.Background(), ".", "lfs", "version") == nil
+}
+
+// LFSPull downloads and checks out the LFS objects of the current checkout.
+func LFSPull(ctx context.Context, repoDir string) error {
+	return run(ctx, repoDir, "lfs", "pull")
+}
+
 // HasRemote returns true if the git repository has at least one remote configured.
 func HasRemote(repoDir string) bool {
-	out, err := outputQuiet(repoDir, "remote")
+	out, err := output(context.Background(), repoDir, "remote")
 	if err != nil {
 		return false
 	}
@@ -184,28 +643,6 @@ func IsCloned(repoDir string) bool {
 	return info.IsDir()
 }
 
-// run executes a git command in the given directory.
-func run(dir string, args ...string) error {
-	cmd := exec.Command("git", args...)
-	cmd.Dir = dir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
-// output executes a git command and returns its stdout.
-func output(dir string, args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
-	cmd.Dir = dir
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
-	}
-	return stdout.String(), nil
-}
-
 // IsGitInstalled returns true if git is available on the system PATH.
 func IsGitInstalled() bool {
 	_, err := exec.LookPath("git")
@@ -214,71 +651,77 @@ func IsGitInstalled() bool {
 
 // Init runs git init in the given directory.
 func Init(dir string) error {
-	return runQuiet(dir, "init")
+	return run(context.Background(), dir, "init")
 }
 
 // InitWithBranch runs git init with a specific initial branch name.
 func InitWithBranch(dir, branch string) error {
-	return runQuiet(dir, "init", "-b", branch)
+	return run(context.Background(), dir, "init", "-b", branch)
 }
 
 // Add stages the given paths in the repository.
 func Add(dir string, paths ...string) error {
 	args := append([]string{"add", "--"}, paths...)
-	return runQuiet(dir, args...)
+	return run(context.Background(), dir, args...)
 }
 
-// Commit creates a commit with the given message.
+// Commit creates a commit with the given message. With paths, only those
+// paths are committed, leaving anything else that is staged alone.
 // If user.name or user.email is not configured globally, it sets repo-local fallback values.
-func Commit(dir, message string) error {
+func Commit(dir, message string, paths ...string) error {
 	if err := ensureCommitIdentity(dir); err != nil {
 		return fmt.Errorf("setting commit identity: %w", err)
 	}
-	return runQuiet(dir, "commit", "-m", message)
+	args := []string{"commit", "-m", message}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	return run(context.Background(), dir, args...)
+}
+
+// CheckoutFile restores path (relative to dir) in the index and the worktree
+// to its content at rev, discarding uncommitted changes to it.
+func CheckoutFile(dir, rev, path string) error {
+	return run(context.Background(), dir, "checkout", rev, "--", path)
+}
+
+// Push pushes the current branch to its upstream.
+func Push(ctx context.Context, dir string) error {
+	return run(ctx, dir, "push", "--quiet")
+}
+
+// FileAt returns the content of path (relative to dir) at rev. ok is false
+// if rev does not exist or does not contain path.
+func FileAt(dir, rev, path string) (content string, ok bool, err error) {
+	object := rev + ":./" + filepath.ToSlash(path)
+	if run(context.Background(), dir, "cat-file", "-e", object) != nil {
+		return "", false, nil
+	}
+	out, err := output(context.Background(), dir, "show", object)
+	if err != nil {
+		return "", false, err
+	}
+	return out, true, nil
 }
 
 // ensureCommitIdentity sets repo-local user.name/user.email if they are not configured.
 func ensureCommitIdentity(dir string) error {
-	if _, err := outputQuiet(dir, "config", "user.name"); err != nil {
-		if err2 := runQuiet(dir, "config", "user.name", "agentws"); err2 != nil {
+	if _, err := output(context.Background(), dir, "config", "user.name"); err != nil {
+		if err2 := run(context.Background(), dir, "config", "user.name", "agentws"); err2 != nil {
 			return err2
 		}
 	}
-	if _, err := outputQuiet(dir, "config", "user.email"); err != nil {
-		if err2 := runQuiet(dir, "config", "user.email", "agentws@localhost"); err2 != nil {
+	if _, err := output(context.Background(), dir, "config", "user.email"); err != nil {
+		if err2 := run(context.Background(), dir, "config", "user.email", "agentws@localhost"); err2 != nil {
 			return err2
 		}
 	}
 	return nil
 }
 
-// runQuiet executes a git command without printing stdout.
-// Stderr is captured and included in the error message on failure.
-func runQuiet(dir string, args ...string) error {
-	cmd := exec.Command("git", args...)
-	cmd.Dir = dir
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, stderr.String())
-	}
-	return nil
-}
-
-// outputQuiet executes a git command and returns its stdout without printing to the console.
-func outputQuiet(dir string, args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
-	cmd.Dir = dir
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, stderr.String())
-	}
-	return stdout.String(), nil
-}
-
+// isExitError reports whether err is git exiting with a non-zero status (as
+// opposed to git failing to start).
 func isExitError(err error) bool {
-	_, ok := err.(*exec.ExitError)
-	return ok
+	var exit interface{ ExitCode() int }
+	return errors.As(err, &exit)
 }
@@ -1,9 +1,11 @@
 package git
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/fbkclanna/agentws/internal/testutil"
 )
@@ -12,7 +14,7 @@ func TestCloneAndIsCloned(t *testing.T) {
 	bare := testutil.CreateBareRepo(t)
 	dest := filepath.Join(t.TempDir(), "cloned")
 
-	if err := Clone(bare, dest, CloneOpts{}); err != nil {
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
 		t.Fatalf("clone: %v", err)
 	}
 	if !IsCloned(dest) {
@@ -25,7 +27,7 @@ func TestClone_withDepth(t *testing.T) {
 	dest := filepath.Join(t.TempDir(), "shallow")
 	depth := 1
 
-	if err := Clone(bare, dest, CloneOpts{Depth: &depth}); err != nil {
+	if err := Clone(context.Background(), bare, dest, CloneOpts{Depth: &depth}); err != nil {
 		t.Fatalf("clone with depth: %v", err)
 	}
 	if !IsCloned(dest) {
@@ -36,7 +38,7 @@ func TestClone_withDepth(t *testing.T) {
 func TestCurrentBranch(t *testing.T) {
 	bare := testutil.CreateBareRepo(t)
 	dest := filepath.Join(t.TempDir(), "repo")
-	if err := Clone(bare, dest, CloneOpts{}); err != nil {
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
 		t.Fatalf("clone: %v", err)
 	}
 
@@ -53,7 +55,7 @@ func TestCurrentBranch(t *testing.T) {
 func TestHeadCommit(t *testing.T) {
 	bare := testutil.CreateBareRepo(t)
 	dest := filepath.Join(t.TempDir(), "repo")
-	if err := Clone(bare, dest, CloneOpts{}); err != nil {
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
 		t.Fatalf("clone: %v", err)
 	}
 
@@ -66,10 +68,26 @@ func TestHeadCommit(t *testing.T) {
 	}
 }
 
+func TestCommitTime(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	dest := filepath.Join(t.TempDir(), "repo")
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+
+	ts, err := CommitTime(dest, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := time.Parse(time.RFC3339, ts); err != nil {
+		t.Errorf("commit time %q is not RFC 3339: %v", ts, err)
+	}
+}
+
 func TestIsDirty(t *testing.T) {
 	bare := testutil.CreateBareRepo(t)
 	dest := filepath.Join(t.TempDir(), "repo")
-	if err := Clone(bare, dest, CloneOpts{}); err != nil {
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
 		t.Fatalf("clone: %v", err)
 	}
 
@@ -98,7 +116,7 @@ func TestIsDirty(t *testing.T) {
 func TestBranchExists(t *testing.T) {
 	bare := testutil.CreateBareRepoWithBranch(t, "feature/test")
 	dest := filepath.Join(t.TempDir(), "repo")
-	if err := Clone(bare, dest, CloneOpts{}); err != nil {
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
 		t.Fatalf("clone: %v", err)
 	}
 
@@ -124,7 +142,7 @@ func TestBranchExists(t *testing.T) {
 func TestCreateBranch(t *testing.T) {
 	bare := testutil.CreateBareRepo(t)
 	dest := filepath.Join(t.TempDir(), "repo")
-	if err := Clone(bare, dest, CloneOpts{}); err != nil {
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
 		t.Fatalf("clone: %v", err)
 	}
 
@@ -141,7 +159,7 @@ func TestCreateBranch(t *testing.T) {
 func TestCreateBranch_noTrack(t *testing.T) {
 	bare := testutil.CreateBareRepo(t)
 	dest := filepath.Join(t.TempDir(), "repo")
-	if err := Clone(bare, dest, CloneOpts{}); err != nil {
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
 		t.Fatalf("clone: %v", err)
 	}
 
@@ -156,11 +174,11 @@ func TestCreateBranch_noTrack(t *testing.T) {
 	}
 
 	// Verify no upstream tracking is configured.
-	_, err := outputQuiet(dest, "config", "branch.feature-branch.remote")
+	_, err := output(context.Background(), dest, "config", "branch.feature-branch.remote")
 	if err == nil {
 		t.Error("expected no upstream remote to be configured for feature-branch")
 	}
-	_, err = outputQuiet(dest, "config", "branch.feature-branch.merge")
+	_, err = output(context.Background(), dest, "config", "branch.feature-branch.merge")
 	if err == nil {
 		t.Error("expected no upstream merge ref to be configured for feature-branch")
 	}
@@ -169,7 +187,7 @@ func TestCreateBranch_noTrack(t *testing.T) {
 func TestStash(t *testing.T) {
 	bare := testutil.CreateBareRepo(t)
 	dest := filepath.Join(t.TempDir(), "repo")
-	if err := Clone(bare, dest, CloneOpts{}); err != nil {
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
 		t.Fatalf("clone: %v", err)
 	}
 
@@ -259,9 +277,311 @@ func TestAddAndCommit(t *testing.T) {
 	}
 }
 
+func TestCommit_paths(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "repo")
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Add(dir, "a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Commit(dir, "add a", "a.txt"); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	if _, ok, err := FileAt(dir, "HEAD", "a.txt"); err != nil || !ok {
+		t.Errorf("a.txt should be committed (ok=%v, err=%v)", ok, err)
+	}
+	if _, ok, err := FileAt(dir, "HEAD", "b.txt"); err != nil || ok {
+		t.Errorf("b.txt should not be committed (ok=%v, err=%v)", ok, err)
+	}
+	st, err := Status(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Staged != 1 {
+		t.Errorf("b.txt should stay staged, got %d staged", st.Staged)
+	}
+}
+
+func TestFileAt(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	dest := filepath.Join(t.TempDir(), "repo")
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+
+	content, ok, err := FileAt(dest, "HEAD", "README.md")
+	if err != nil || !ok {
+		t.Fatalf("FileAt(README.md) = ok %v, err %v", ok, err)
+	}
+	if content == "" {
+		t.Error("expected README.md content")
+	}
+	if _, ok, err := FileAt(dest, "HEAD", "missing.txt"); err != nil || ok {
+		t.Errorf("FileAt(missing.txt) = ok %v, err %v; want false, nil", ok, err)
+	}
+	if _, ok, err := FileAt(dest, "no-such-rev", "README.md"); err != nil || ok {
+		t.Errorf("FileAt(no-such-rev) = ok %v, err %v; want false, nil", ok, err)
+	}
+}
+
+func TestPush(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	dest := filepath.Join(t.TempDir(), "repo")
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "pushed.txt"), []byte("x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(dest, "pushed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Commit(dest, "push me"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Push(context.Background(), dest); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	head, err := HeadCommitFull(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote, err := ResolveCommit(bare, "HEAD"); err != nil || remote != head {
+		t.Errorf("bare HEAD = %s (err %v), want %s", remote, err, head)
+	}
+}
+
 func TestIsGitInstalled(t *testing.T) {
 	// In a test environment with git available, this should be true.
 	if !IsGitInstalled() {
 		t.Error("expected IsGitInstalled to return true in test environment")
 	}
 }
+
+func TestFetchCommit_shallow(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	dest := filepath.Join(t.TempDir(), "first")
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	first, _ := HeadCommitFull(dest)
+	testutil.PushNewCommits(t, bare, 3)
+
+	depth := 1
+	shallow := filepath.Join(t.TempDir(), "shallow")
+	if err := Clone(context.Background(), "file://"+bare, shallow, CloneOpts{Depth: &depth}); err != nil {
+		t.Fatalf("shallow clone: %v", err)
+	}
+	if !IsShallow(shallow) {
+		t.Fatal("expected shallow clone")
+	}
+	if HasCommit(shallow, first) {
+		t.Fatal("first commit should be outside shallow history")
+	}
+
+	if err := FetchCommit(context.Background(), shallow, first, 1); err != nil {
+		t.Fatalf("FetchCommit: %v", err)
+	}
+	if !HasCommit(shallow, first) {
+		t.Error("expected first commit after FetchCommit")
+	}
+}
+
+func TestDeepenAndUnshallow(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	testutil.PushNewCommits(t, bare, 3)
+
+	depth := 1
+	dest := filepath.Join(t.TempDir(), "shallow")
+	if err := Clone(context.Background(), "file://"+bare, dest, CloneOpts{Depth: &depth}); err != nil {
+		t.Fatalf("shallow clone: %v", err)
+	}
+
+	if err := Deepen(context.Background(), dest, 1); err != nil {
+		t.Fatalf("Deepen: %v", err)
+	}
+	if !IsShallow(dest) {
+		t.Error("expected repo to remain shallow after deepening by 1")
+	}
+
+	if err := Unshallow(context.Background(), dest); err != nil {
+		t.Fatalf("Unshallow: %v", err)
+	}
+	if IsShallow(dest) {
+		t.Error("expected full clone after Unshallow")
+	}
+}
+
+func TestUnpushedBranches(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	dest := filepath.Join(t.TempDir(), "repo")
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+
+	branches, err := UnpushedBranches(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 0 {
+		t.Errorf("expected no unpushed branches after clone, got %v", branches)
+	}
+
+	if err := CreateBranch(dest, "wip", "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "wip.txt"), []byte("wip\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(dest, "wip.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Commit(dest, "wip"); err != nil {
+		t.Fatal(err)
+	}
+
+	branches, err = UnpushedBranches(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 1 || branches[0] != "wip" {
+		t.Errorf("UnpushedBranches() = %v, want [wip]", branches)
+	}
+}
+
+func TestCreateBundleAndCloneBundle(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	src := filepath.Join(t.TempDir(), "src")
+	if err := Clone(context.Background(), bare, src, CloneOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := HeadCommitFull(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "src.bundle")
+	if err := CreateBundle(context.Background(), src, commit, file); err != nil {
+		t.Fatalf("CreateBundle: %v", err)
+	}
+	if _, err := output(context.Background(), src, "rev-parse", "--verify", "--quiet", bundleRef); err == nil {
+		t.Error("temporary bundle ref should be removed")
+	}
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	if err := CloneBundle(context.Background(), file, dest, "main", bare); err != nil {
+		t.Fatalf("CloneBundle: %v", err)
+	}
+	if head, _ := HeadCommitFull(dest); head != commit {
+		t.Errorf("HEAD = %s, want %s", head, commit)
+	}
+	if branch, _ := CurrentBranch(dest); branch != "main" {
+		t.Errorf("branch = %s, want main", branch)
+	}
+	if url, _ := RemoteURL(dest); url != bare {
+		t.Errorf("origin = %s, want %s", url, bare)
+	}
+	if up := Upstream(dest); up != "origin/main" {
+		t.Errorf("upstream = %q, want origin/main", up)
+	}
+}
+
+func TestCloneBundle_detached(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	src := filepath.Join(t.TempDir(), "src")
+	if err := Clone(context.Background(), bare, src, CloneOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := HeadCommitFull(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "repo.bundle")
+	if err := CreateBundle(context.Background(), src, commit, file); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	if err := CloneBundle(context.Background(), file, dest, "", bare); err != nil {
+		t.Fatalf("CloneBundle: %v", err)
+	}
+	if head, _ := HeadCommitFull(dest); head != commit {
+		t.Errorf("HEAD = %s, want %s", head, commit)
+	}
+	if branch, _ := CurrentBranch(dest); branch != "" {
+		t.Errorf("HEAD should be detached, on branch %q", branch)
+	}
+	if url, _ := RemoteURL(dest); url != bare {
+		t.Errorf("origin = %s, want %s", url, bare)
+	}
+}
+
+func TestSubmodules_pathWithSpaces(t *testing.T) {
+	sub := testutil.CreateBareRepo(t)
+	bare := testutil.CreateBareRepoWithSubmodule(t, sub, "lib/my sub")
+	dest := filepath.Join(t.TempDir(), "clone")
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := Submodules(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].Path != "lib/my sub" {
+		t.Fatalf("uninitialized: expected path %q, got %+v", "lib/my sub", subs)
+	}
+
+	if err := SubmoduleUpdate(context.Background(), dest, false); err != nil {
+		t.Fatal(err)
+	}
+	subs, err = Submodules(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].Path != "lib/my sub" || !subs[0].Initialized {
+		t.Fatalf("initialized: expected path %q, got %+v", "lib/my sub", subs)
+	}
+}
+
+func TestSubmoduleUpdateAndStatus(t *testing.T) {
+	sub := testutil.CreateBareRepo(t)
+	bare := testutil.CreateBareRepoWithSubmodule(t, sub, "lib/sub")
+	dest := filepath.Join(t.TempDir(), "clone")
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := Submodules(dest)
+	if err != nil {
+		t.Fatalf("Submodules: %v", err)
+	}
+	if len(subs) != 1 || subs[0].Path != "lib/sub" || subs[0].Initialized {
+		t.Fatalf("expected one uninitialized submodule, got %+v", subs)
+	}
+
+	if err := SubmoduleUpdate(context.Background(), dest, false); err != nil {
+		t.Fatalf("SubmoduleUpdate: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "lib", "sub", "README.md")); err != nil {
+		t.Errorf("submodule content should be checked out: %v", err)
+	}
+	subs, err = Submodules(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !subs[0].Initialized || subs[0].OutOfDate {
+		t.Errorf("submodule should be initialized and current: %+v", subs[0])
+	}
+}
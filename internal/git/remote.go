@@ -0,0 +1,227 @@
+package git
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// URLHost returns the lower-cased host name of a remote URL, without user or
+// port. It understands scheme URLs (https://host/org/repo.git,
+// ssh://git@host:22/org/repo.git) and scp-like SSH syntax
+// (git@host:org/repo.git). Local paths and file:// URLs return "".
+func URLHost(remote string) string {
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil || u.Scheme == "file" {
+			return ""
+		}
+		return strings.ToLower(u.Hostname())
+	}
+	// scp-like syntax is only recognized when no slash precedes the first
+	// colon, matching git's own rule; anything else is a local path.
+	colon := strings.Index(remote, ":")
+	if colon <= 0 || strings.Contains(remote[:colon], "/") {
+		return ""
+	}
+	host := remote[:colon]
+	if at := strings.LastIndex(host, "@"); at != -1 {
+		host = host[at+1:]
+	}
+	if len(host) == 1 {
+		// A Windows drive letter such as C:\repos\x.
+		return ""
+	}
+	return strings.ToLower(host)
+}
+
+// rateLimitMarkers are fragments of git/ssh/HTTP error output that indicate
+// the server is throttling us rather than failing for good.
+var rateLimitMarkers = []string{
+	"rate limit",
+	"too many requests",
+	"too many connections",
+	"returned error: 429",
+	"http 429",
+	"kex_exchange_identification",
+	"connection limit",
+}
+
+// IsRateLimited reports whether err (whose message includes git's stderr)
+// looks like the server throttling connections, as opposed to a permanent
+// failure such as a missing repository.
+func IsRateLimited(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range rateLimitMarkers {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteUnchanged reports whether fetching origin would leave the
+// remote-tracking branches as they are: every branch that the fetch refspecs
+// map to a local ref points at the same commit on origin (checked with
+// ls-remote), and no tracked branch was deleted. Tags are not compared.
+func RemoteUnchanged(ctx context.Context, repoDir string) (bool, error) {
+	out, err := output(ctx, repoDir, "config", "--get-all", "remote.origin.fetch")
+	if err != nil {
+		return false, err
+	}
+	specs := strings.Fields(out)
+	for _, spec := range specs {
+		if strings.HasPrefix(spec, "^") {
+			// Negative refspecs: let fetch work it out.
+			return false, nil
+		}
+	}
+
+	out, err = output(ctx, repoDir, "ls-remote", "--heads", "origin")
+	if err != nil {
+		return false, err
+	}
+	want := make(map[string]string)
+	for ref, sha := range parseRefList(out, "\t") {
+		for _, spec := range specs {
+			if dst, ok := mapRefspec(spec, ref); ok {
+				want[dst] = sha
+			}
+		}
+	}
+
+	out, err = output(ctx, repoDir, "for-each-ref", "--format=%(objectname) %(refname)")
+	if err != nil {
+		return false, err
+	}
+	have := make(map[string]string)
+	for ref, sha := range parseRefList(out, " ") {
+		if strings.HasSuffix(ref, "/HEAD") {
+			// refs/remotes/origin/HEAD is set by clone, not by fetch.
+			continue
+		}
+		for _, spec := range specs {
+			if refspecCovers(spec, ref) {
+				have[ref] = sha
+				break
+			}
+		}
+	}
+
+	if len(want) != len(have) {
+		return false, nil
+	}
+	for ref, sha := range want {
+		if have[ref] != sha {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// LsRemote lists the refs of remote (a remote name or URL) matching
+// patterns, as a map from ref name to commit. Annotated tags also appear
+// peeled, as "refs/tags/<tag>^{}". It runs in repoDir, which may be "." when
+// there is no clone yet.
+func LsRemote(ctx context.Context, repoDir, remote string, patterns ...string) (map[string]string, error) {
+	args := append([]string{"ls-remote", remote}, patterns...)
+	out, err := output(ctx, repoDir, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseRefList(out, "\t"), nil
+}
+
+// FetchTrackingBranch fetches a single branch from origin into its
+// remote-tracking ref, leaving local branches and the worktree untouched.
+func FetchTrackingBranch(ctx context.Context, repoDir, branch string) error {
+	return run(ctx, repoDir, "fetch", "--no-write-fetch-head", "--no-tags", "origin", "+refs/heads/"+branch+":refs/remotes/origin/"+branch)
+}
+
+// fetchStamp is the file (in the git directory) whose mtime records the last
+// successful Fetch. FETCH_HEAD cannot be used: fetches of single refs and
+// failed fetches rewrite it as well.
+const fetchStamp = "agentws-fetched"
+
+// LastFetch returns when the repository was last fetched successfully with
+// Fetch. ok is false if it has not been.
+func LastFetch(repoDir string) (t time.Time, ok bool) {
+	path, err := gitPath(repoDir, fetchStamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return fi.ModTime(), true
+}
+
+// gitPath resolves a path inside the git directory of repoDir.
+func gitPath(repoDir, name string) (string, error) {
+	out, err := output(context.Background(), repoDir, "rev-parse", "--git-path", name)
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSpace(out)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(repoDir, path)
+	}
+	return path, nil
+}
+
+// parseRefList parses "<sha><sep><ref>" lines as printed by ls-remote and
+// for-each-ref into a map from ref to sha.
+func parseRefList(out, sep string) map[string]string {
+	refs := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		sha, ref, ok := strings.Cut(line, sep)
+		if ok {
+			refs[ref] = sha
+		}
+	}
+	return refs
+}
+
+// mapRefspec applies a fetch refspec ("+refs/heads/*:refs/remotes/origin/*")
+// to a remote ref and returns the local ref it would update.
+func mapRefspec(spec, ref string) (string, bool) {
+	src, dst, ok := strings.Cut(strings.TrimPrefix(spec, "+"), ":")
+	if !ok || dst == "" {
+		return "", false
+	}
+	star, ok := matchRefPattern(src, ref)
+	if !ok {
+		return "", false
+	}
+	return strings.Replace(dst, "*", star, 1), true
+}
+
+// refspecCovers reports whether a local ref is a destination of spec.
+func refspecCovers(spec, ref string) bool {
+	_, dst, ok := strings.Cut(strings.TrimPrefix(spec, "+"), ":")
+	if !ok || dst == "" {
+		return false
+	}
+	_, ok = matchRefPattern(dst, ref)
+	return ok
+}
+
+// matchRefPattern matches ref against a refspec side that contains at most
+// one "*", returning the part matched by the "*".
+func matchRefPattern(pattern, ref string) (string, bool) {
+	prefix, suffix, glob := strings.Cut(pattern, "*")
+	if !glob {
+		return "", pattern == ref
+	}
+	if len(ref) < len(prefix)+len(suffix) || !strings.HasPrefix(ref, prefix) || !strings.HasSuffix(ref, suffix) {
+		return "", false
+	}
+	return ref[len(prefix) : len(ref)-len(suffix)], true
+}
@@ -0,0 +1,116 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cmd is a single git invocation.
+type Cmd struct {
+	Dir    string
+	Args   []string  // arguments after "git"
+	Env    []string  // extra environment variables ("KEY=value")
+	Stdout io.Writer // nil discards output
+	Stderr io.Writer // nil discards output
+}
+
+// String renders the invocation as a command line.
+func (c Cmd) String() string {
+	return "git " + strings.Join(c.Args, " ")
+}
+
+// Runner executes git commands. All functions in this package go through the
+// runner installed with SetRunner.
+type Runner interface {
+	Run(ctx context.Context, cmd Cmd) error
+}
+
+// ExecRunner runs git as a subprocess.
+type ExecRunner struct{}
+
+// Run executes cmd and waits for it to finish. The process is killed when ctx
+// is cancelled.
+func (ExecRunner) Run(ctx context.Context, cmd Cmd) error {
+	c := exec.CommandContext(ctx, "git", cmd.Args...)
+	c.Dir = cmd.Dir
+	if len(cmd.Env) > 0 {
+		c.Env = append(os.Environ(), cmd.Env...)
+	}
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	return c.Run()
+}
+
+var (
+	runnerMu sync.RWMutex
+	runner   Runner = ExecRunner{}
+)
+
+// SetRunner installs r for all subsequent git calls and returns the previous
+// runner, so callers (typically tests) can restore it.
+func SetRunner(r Runner) Runner {
+	runnerMu.Lock()
+	defer runnerMu.Unlock()
+	prev := runner
+	runner = r
+	return prev
+}
+
+func currentRunner() Runner {
+	runnerMu.RLock()
+	defer runnerMu.RUnlock()
+	return runner
+}
+
+// traceRunner logs every invocation with its duration.
+type traceRunner struct {
+	next Runner
+	mu   sync.Mutex
+	out  io.Writer
+}
+
+// Trace wraps next so that every git invocation is logged to out with its
+// working directory, duration and outcome.
+func Trace(next Runner, out io.Writer) Runner {
+	return &traceRunner{next: next, out: out}
+}
+
+func (t *traceRunner) Run(ctx context.Context, cmd Cmd) error {
+	start := time.Now()
+	err := t.next.Run(ctx, cmd)
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	status := "ok"
+	if err != nil {
+		status = err.Error()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _ = fmt.Fprintf(t.out, "[trace] %s (in %s) %s: %s\n", cmd, cmd.Dir, elapsed, status)
+	return err
+}
+
+// run executes a git command in dir, discarding stdout. Stderr is included
+// in the returned error on failure.
+func run(ctx context.Context, dir string, args ...string) error {
+	_, err := output(ctx, dir, args...)
+	return err
+}
+
+// output executes a git command in dir and returns its stdout. Stderr is
+// included in the returned error on failure.
+func output(ctx context.Context, dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	err := currentRunner().Run(ctx, Cmd{Dir: dir, Args: args, Stdout: &stdout, Stderr: &stderr})
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
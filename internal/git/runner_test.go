@@ -0,0 +1,84 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// useFake installs a FakeRunner for the duration of the test.
+func useFake(t *testing.T) *FakeRunner {
+	t.Helper()
+	fake := &FakeRunner{}
+	prev := SetRunner(fake)
+	t.Cleanup(func() { SetRunner(prev) })
+	return fake
+}
+
+func TestFakeRunner_currentBranch(t *testing.T) {
+	fake := useFake(t)
+	fake.On("symbolic-ref --short HEAD", "feature/x\n", nil)
+
+	branch, err := CurrentBranch("/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch != "feature/x" {
+		t.Errorf("branch = %q, want feature/x", branch)
+	}
+	if calls := fake.Calls(); len(calls) != 1 || calls[0] != "git symbolic-ref --short HEAD" {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+}
+
+func TestFakeRunner_exitStatus(t *testing.T) {
+	fake := useFake(t)
+	fake.On("show-ref", "", ExitStatus(1))
+
+	exists, err := BranchExists("/repo", "nope")
+	if err != nil {
+		t.Fatalf("exit status 1 should mean missing branch, got error %v", err)
+	}
+	if exists {
+		t.Error("branch should not exist")
+	}
+
+	fake.On("show-ref", "", errors.New("git not found"))
+	if _, err := BranchExists("/repo", "nope"); err == nil {
+		t.Error("non-exit errors should be returned")
+	}
+}
+
+func TestFakeRunner_errorIncludesCommand(t *testing.T) {
+	fake := useFake(t)
+	fake.On("fetch", "", ExitStatus(128))
+
+	err := Fetch(context.Background(), "/repo")
+	if err == nil || !strings.Contains(err.Error(), "git fetch --prune") {
+		t.Errorf("error should name the command, got %v", err)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	fake := &FakeRunner{}
+	fake.On("checkout", "", ExitStatus(1))
+	var buf bytes.Buffer
+	prev := SetRunner(Trace(fake, &buf))
+	t.Cleanup(func() { SetRunner(prev) })
+
+	_ = Checkout("/repo", "main")
+	_, _ = CurrentBranch("/repo")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 trace lines, got %q", buf.String())
+	}
+	if !strings.Contains(lines[0], "git checkout main (in /repo)") || !strings.Contains(lines[0], "exit status 1") {
+		t.Errorf("unexpected trace line: %s", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], ": ok") {
+		t.Errorf("unexpected trace line: %s", lines[1])
+	}
+}
@@ -0,0 +1,201 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RepoStatus is the parsed output of `git status --porcelain=v2 --branch`.
+type RepoStatus struct {
+	// Branch is the checked-out branch, or empty if HEAD is detached.
+	Branch string
+	// Head is the full SHA of HEAD, or empty before the first commit.
+	Head string
+	// Upstream is the upstream of Branch (e.g. "origin/main"), if any.
+	Upstream string
+	// UpstreamGone is set when Upstream is configured but no longer exists.
+	UpstreamGone bool
+	// Ahead and Behind count commits relative to Upstream. They are zero when
+	// there is no upstream or it is gone.
+	Ahead, Behind int
+
+	Staged     int
+	Modified   int
+	Untracked  int
+	Conflicted int
+
+	// Entries lists every changed, untracked or conflicted path.
+	Entries []StatusEntry
+}
+
+// StatusEntry is a single path reported by git status.
+type StatusEntry struct {
+	Path string
+	// OrigPath is the source path of a rename or copy.
+	OrigPath string
+	// XY is the two-letter status code ("." means unmodified); untracked
+	// files use "??".
+	XY         string
+	Conflicted bool
+}
+
+// Dirty reports whether the working tree or index has any changes, including
+// untracked files.
+func (s *RepoStatus) Dirty() bool {
+	return len(s.Entries) > 0
+}
+
+// Status reads the branch and working tree state of the repository.
+func Status(repoDir string) (*RepoStatus, error) {
+	out, err := output(context.Background(), repoDir, "status", "--porcelain=v2", "--branch", "-z")
+	if err != nil {
+		return nil, err
+	}
+	return parseStatus(out)
+}
+
+// parseStatus parses NUL-separated porcelain v2 output.
+func parseStatus(out string) (*RepoStatus, error) {
+	s := &RepoStatus{}
+	sawAB := false
+	records := strings.Split(out, "\x00")
+	for i := 0; i < len(records); i++ {
+		rec := records[i]
+		if rec == "" {
+			continue
+		}
+		switch rec[0] {
+		case '#':
+			if strings.HasPrefix(rec, "# branch.ab ") {
+				sawAB = true
+			}
+			if err := s.parseHeader(rec); err != nil {
+				return nil, err
+			}
+		case '1':
+			// 1 XY sub mH mI mW hH hI path
+			fields := strings.SplitN(rec, " ", 9)
+			if len(fields) != 9 {
+				return nil, fmt.Errorf("parsing status entry %q", rec)
+			}
+			s.addChange(StatusEntry{Path: fields[8], XY: fields[1]})
+		case '2':
+			// 2 XY sub mH mI mW hH hI Xscore path, followed by origPath.
+			fields := strings.SplitN(rec, " ", 10)
+			if len(fields) != 10 || i+1 >= len(records) {
+				return nil, fmt.Errorf("parsing status entry %q", rec)
+			}
+			i++
+			s.addChange(StatusEntry{Path: fields[9], OrigPath: records[i], XY: fields[1]})
+		case 'u':
+			// u XY sub m1 m2 m3 mW h1 h2 h3 path
+			fields := strings.SplitN(rec, " ", 11)
+			if len(fields) != 11 {
+				return nil, fmt.Errorf("parsing status entry %q", rec)
+			}
+			s.Conflicted++
+			s.Entries = append(s.Entries, StatusEntry{Path: fields[10], XY: fields[1], Conflicted: true})
+		case '?':
+			s.Untracked++
+			s.Entries = append(s.Entries, StatusEntry{Path: strings.TrimPrefix(rec, "? "), XY: "??"})
+		case '!':
+			// Ignored files are only listed with --ignored.
+		default:
+			return nil, fmt.Errorf("parsing status entry %q", rec)
+		}
+	}
+	s.UpstreamGone = s.Upstream != "" && !sawAB
+	return s, nil
+}
+
+func (s *RepoStatus) parseHeader(rec string) error {
+	key, value, _ := strings.Cut(strings.TrimPrefix(rec, "# "), " ")
+	switch key {
+	case "branch.oid":
+		if value != "(initial)" {
+			s.Head = value
+		}
+	case "branch.head":
+		if value != "(detached)" {
+			s.Branch = value
+		}
+	case "branch.upstream":
+		s.Upstream = value
+	case "branch.ab":
+		if _, err := fmt.Sscanf(value, "+%d -%d", &s.Ahead, &s.Behind); err != nil {
+			return fmt.Errorf("parsing status header %q: %w", rec, err)
+		}
+	}
+	return nil
+}
+
+func (s *RepoStatus) addChange(e StatusEntry) {
+	if len(e.XY) != 2 {
+		e.XY = ".."
+	}
+	if e.XY[0] != '.' {
+		s.Staged++
+	}
+	if e.XY[1] != '.' {
+		s.Modified++
+	}
+	s.Entries = append(s.Entries, e)
+}
+
+// Operations reported by InProgress.
+const (
+	OpMerge      = "merge"
+	OpRebase     = "rebase"
+	OpAm         = "am"
+	OpCherryPick = "cherry-pick"
+	OpRevert     = "revert"
+	OpBisect     = "bisect"
+)
+
+// InProgress returns the multi-step operation that is stopped in the
+// repository (one of the Op constants), or an empty string if there is none.
+func InProgress(repoDir string) (string, error) {
+	out, err := output(context.Background(), repoDir, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	gitDir := strings.TrimSpace(out)
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(gitDir, name))
+		return err == nil
+	}
+	switch {
+	case exists("rebase-merge"):
+		return OpRebase, nil
+	case exists("rebase-apply"):
+		if exists(filepath.Join("rebase-apply", "applying")) {
+			return OpAm, nil
+		}
+		return OpRebase, nil
+	case exists("MERGE_HEAD"):
+		return OpMerge, nil
+	case exists("CHERRY_PICK_HEAD"):
+		return OpCherryPick, nil
+	case exists("REVERT_HEAD"):
+		return OpRevert, nil
+	case exists("BISECT_LOG"):
+		return OpBisect, nil
+	}
+	return "", nil
+}
+
+// StashCount returns the number of stash entries.
+func StashCount(repoDir string) (int, error) {
+	out, err := output(context.Background(), repoDir, "stash", "list")
+	if err != nil {
+		return 0, err
+	}
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return 0, nil
+	}
+	return strings.Count(out, "\n") + 1, nil
+}
@@ -0,0 +1,178 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fbkclanna/agentws/internal/testutil"
+)
+
+func TestParseStatus(t *testing.T) {
+	out := strings.Join([]string{
+		"# branch.oid 1111111111111111111111111111111111111111",
+		"# branch.head main",
+		"# branch.upstream origin/main",
+		"# branch.ab +2 -3",
+		"1 M. N... 100644 100644 100644 aaaa bbbb staged.go",
+		"1 .M N... 100644 100644 100644 aaaa aaaa modified.go",
+		"1 MM N... 100644 100644 100644 aaaa bbbb both.go",
+		"2 R. N... 100644 100644 100644 aaaa aaaa R100 new name.go",
+		"old name.go",
+		"u UU N... 100644 100644 100644 100644 aaaa bbbb cccc conflict.go",
+		"? untracked dir/file.txt",
+		"",
+	}, "\x00")
+
+	st, err := parseStatus(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Branch != "main" || st.Upstream != "origin/main" || st.Ahead != 2 || st.Behind != 3 {
+		t.Errorf("unexpected branch info: %+v", st)
+	}
+	if st.Head != strings.Repeat("1", 40) {
+		t.Errorf("Head = %q", st.Head)
+	}
+	if st.Staged != 3 || st.Modified != 2 || st.Untracked != 1 || st.Conflicted != 1 {
+		t.Errorf("counts = staged %d, modified %d, untracked %d, conflicted %d",
+			st.Staged, st.Modified, st.Untracked, st.Conflicted)
+	}
+	if len(st.Entries) != 6 {
+		t.Fatalf("expected 6 entries, got %+v", st.Entries)
+	}
+	if e := st.Entries[3]; e.Path != "new name.go" || e.OrigPath != "old name.go" {
+		t.Errorf("unexpected rename entry: %+v", e)
+	}
+	if e := st.Entries[4]; !e.Conflicted || e.Path != "conflict.go" {
+		t.Errorf("unexpected conflict entry: %+v", e)
+	}
+	if e := st.Entries[5]; e.XY != "??" || e.Path != "untracked dir/file.txt" {
+		t.Errorf("unexpected untracked entry: %+v", e)
+	}
+}
+
+func TestParseStatus_detachedInitial(t *testing.T) {
+	st, err := parseStatus("# branch.oid (initial)\x00# branch.head (detached)\x00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Branch != "" || st.Head != "" || st.Dirty() {
+		t.Errorf("unexpected status: %+v", st)
+	}
+}
+
+func TestParseStatus_upstreamGone(t *testing.T) {
+	st, err := parseStatus("# branch.oid abc\x00# branch.head feature\x00# branch.upstream origin/feature\x00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.UpstreamGone {
+		t.Error("upstream without ahead/behind should be reported as gone")
+	}
+}
+
+func TestParseStatus_invalid(t *testing.T) {
+	if _, err := parseStatus("1 M. short\x00"); err == nil {
+		t.Error("expected error for truncated entry")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	dest := filepath.Join(t.TempDir(), "repo")
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+
+	st, err := Status(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Branch != "main" || st.Upstream != "origin/main" || st.Dirty() {
+		t.Errorf("unexpected status after clone: %+v", st)
+	}
+
+	if err := os.WriteFile(filepath.Join(dest, "README.md"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "new.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	st, err = Status(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Modified != 1 || st.Untracked != 1 || st.Staged != 0 {
+		t.Errorf("unexpected counts: %+v", st)
+	}
+}
+
+func TestInProgressAndStashCount(t *testing.T) {
+	bare := testutil.CreateBareRepo(t)
+	dest := filepath.Join(t.TempDir(), "repo")
+	if err := Clone(context.Background(), bare, dest, CloneOpts{}); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	gitIn := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dest
+		_ = cmd.Run()
+	}
+	gitIn("config", "user.email", "test@example.com")
+	gitIn("config", "user.name", "Test")
+
+	if op, err := InProgress(dest); err != nil || op != "" {
+		t.Fatalf("InProgress on clean clone = %q, %v", op, err)
+	}
+
+	// Create conflicting commits on two branches and merge them.
+	gitIn("checkout", "-b", "other")
+	writeAndCommit(t, dest, gitIn, "other\n")
+	gitIn("checkout", "main")
+	writeAndCommit(t, dest, gitIn, "main\n")
+	gitIn("merge", "other")
+
+	op, err := InProgress(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != OpMerge {
+		t.Errorf("InProgress = %q, want %q", op, OpMerge)
+	}
+	st, err := Status(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Conflicted != 1 {
+		t.Errorf("Conflicted = %d, want 1", st.Conflicted)
+	}
+	gitIn("merge", "--abort")
+
+	if n, err := StashCount(dest); err != nil || n != 0 {
+		t.Fatalf("StashCount = %d, %v; want 0", n, err)
+	}
+	for _, content := range []string{"a\n", "b\n"} {
+		if err := os.WriteFile(filepath.Join(dest, "README.md"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := Stash(dest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := StashCount(dest); err != nil || n != 2 {
+		t.Errorf("StashCount = %d, %v; want 2", n, err)
+	}
+}
+
+func writeAndCommit(t *testing.T, dir string, gitIn func(...string), content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitIn("commit", "-am", "change readme")
+}
@@ -1,5 +1,12 @@
 package lock
 
+// Version is the lock schema version written by this build. Files with an
+// older version are read as is; fields they lack are left empty.
+//
+//	1: url, ref, ref_type, default_branch, commit
+//	2: adds branch, commit_time, sparse, depth, submodules and dirty
+const Version = 2
+
 // File represents workspace.lock.yaml.
 type File struct {
 	Version     int              `yaml:"version"`
@@ -11,7 +18,35 @@ type File struct {
 
 // Repo records the pinned state of a single repository.
 type Repo struct {
-	URL    string `yaml:"url,omitempty"`
-	Ref    string `yaml:"ref"`
+	URL           string `yaml:"url,omitempty"`
+	Ref           string `yaml:"ref"`
+	RefType       string `yaml:"ref_type,omitempty"`
+	DefaultBranch string `yaml:"default_branch,omitempty"` // cached for repos without a manifest ref
+	Commit        string `yaml:"commit"`
+
+	Branch     string      `yaml:"branch,omitempty"`      // checked-out branch; empty if HEAD was detached
+	CommitTime string      `yaml:"commit_time,omitempty"` // committer date of Commit (RFC 3339)
+	Sparse     *Sparse     `yaml:"sparse,omitempty"`      // nil for a full checkout
+	Depth      int         `yaml:"depth,omitempty"`       // commits in a shallow clone; 0 for full history
+	Submodules []Submodule `yaml:"submodules,omitempty"`  // initialized submodules, recursively
+	Dirty      bool        `yaml:"dirty,omitempty"`       // uncommitted changes were not captured
+}
+
+// Sparse records the sparse-checkout configuration of a clone.
+type Sparse struct {
+	Cone  bool     `yaml:"cone"`
+	Paths []string `yaml:"paths,omitempty"`
+}
+
+// Submodule records the checked-out commit of a submodule.
+type Submodule struct {
+	Path   string `yaml:"path"`
 	Commit string `yaml:"commit"`
 }
+
+// HasCloneState reports whether f was written with schema version 2 or
+// later. Only then do empty sparse, depth and submodules fields of its
+// entries mean a full checkout, full history and no submodules.
+func (f *File) HasCloneState() bool {
+	return f.Version >= 2
+}
@@ -3,6 +3,7 @@ package lock
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,21 +17,28 @@ func Load(path string) (*File, error) {
 	return Parse(data)
 }
 
-// Parse parses workspace.lock.yaml content.
+// Parse parses workspace.lock.yaml content. Files written by older versions
+// are accepted; files from a newer schema version are rejected.
 func Parse(data []byte) (*File, error) {
 	var lf File
 	if err := yaml.Unmarshal(data, &lf); err != nil {
 		return nil, fmt.Errorf("parsing lock YAML: %w", err)
 	}
+	if lf.Version > Version {
+		return nil, fmt.Errorf("lock file version %d is newer than this agentws supports (%d); upgrade agentws", lf.Version, Version)
+	}
 	return &lf, nil
 }
 
-// Save writes the lock file to disk.
+// Save writes the lock file to disk, creating its parent directory if needed.
 func Save(path string, lf *File) error {
 	data, err := yaml.Marshal(lf)
 	if err != nil {
 		return fmt.Errorf("marshaling lock file: %w", err)
 	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating lock directory: %w", err)
+	}
 	if err := os.WriteFile(path, data, 0644); err != nil {
 		return fmt.Errorf("writing lock file: %w", err)
 	}
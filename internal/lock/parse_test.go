@@ -3,6 +3,7 @@ package lock
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -81,3 +82,47 @@ func TestSaveAndLoad(t *testing.T) {
 		t.Errorf("commit = %q, want %q", loaded.Repos["svc"].Commit, "abc123")
 	}
 }
+
+func TestParse_version2(t *testing.T) {
+	lf, err := Parse([]byte(`
+version: 2
+name: foo
+generated_at: "2026-10-18T09:00:00Z"
+tool_version: "0.9.0"
+repos:
+  backend:
+    url: git@github.com:org/foo-backend.git
+    ref: main
+    commit: a1b2c3d4e5f6
+    branch: main
+    commit_time: "2026-10-17T18:22:05+02:00"
+    sparse:
+      cone: true
+      paths: [api, docs]
+    depth: 50
+    submodules:
+      - path: vendor/lib
+        commit: 0123456789ab
+    dirty: true
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	be := lf.Repos["backend"]
+	if be.Branch != "main" || be.Depth != 50 || !be.Dirty || be.CommitTime == "" {
+		t.Errorf("unexpected repo: %+v", be)
+	}
+	if be.Sparse == nil || !be.Sparse.Cone || len(be.Sparse.Paths) != 2 {
+		t.Errorf("sparse = %+v", be.Sparse)
+	}
+	if len(be.Submodules) != 1 || be.Submodules[0].Path != "vendor/lib" {
+		t.Errorf("submodules = %+v", be.Submodules)
+	}
+}
+
+func TestParse_newerVersion(t *testing.T) {
+	_, err := Parse([]byte("version: 99\nname: foo\nrepos: {}\n"))
+	if err == nil || !strings.Contains(err.Error(), "upgrade agentws") {
+		t.Errorf("expected version error, got %v", err)
+	}
+}
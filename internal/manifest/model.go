@@ -14,12 +14,53 @@ type Workspace struct {
 // Defaults defines default clone/checkout options applied to all repos
 // unless overridden at the repo level.
 type Defaults struct {
-	Depth          *int   `yaml:"depth,omitempty"`
-	PartialClone   bool   `yaml:"partial_clone,omitempty"`
-	SparseCheckout bool   `yaml:"sparse_checkout,omitempty"`
-	BaseRef        string `yaml:"base_ref,omitempty"`
+	Depth        *int   `yaml:"depth,omitempty"`
+	PartialClone bool   `yaml:"partial_clone,omitempty"`
+	BaseRef      string `yaml:"base_ref,omitempty"`
+	Update       string `yaml:"update,omitempty"`
+	Submodules   string `yaml:"submodules,omitempty"`
+	LFS          bool   `yaml:"lfs,omitempty"`
+	// Deprecated: SparseCheckout is ignored; a repo is checked out sparsely
+	// when it lists sparse paths. It is still parsed so that existing
+	// manifests load, and reported by Deprecations.
+	SparseCheckout *bool `yaml:"sparse_checkout,omitempty"`
+	// HostLimits caps how many repos on each host (e.g. "github.com") sync
+	// at the same time, on top of --jobs.
+	HostLimits map[string]int `yaml:"host_limits,omitempty"`
+	// CommitLock makes pin and sync --update-lock commit the lock file to
+	// the workspace git repository, as with --commit.
+	CommitLock bool `yaml:"commit_lock,omitempty"`
 }
 
+// Update modes controlling how sync moves a checked-out branch to its upstream.
+const (
+	UpdateFFOnly = "ff-only"
+	UpdateRebase = "rebase"
+	UpdateNone   = "none"
+)
+
+// EffectiveUpdate returns the update mode, defaulting to ff-only.
+func (d Defaults) EffectiveUpdate() string {
+	if d.Update != "" {
+		return d.Update
+	}
+	return UpdateFFOnly
+}
+
+// Submodule modes controlling how sync initializes and updates submodules.
+const (
+	SubmodulesRecursive = "recursive"
+	SubmodulesShallow   = "shallow"
+	SubmodulesNone      = "none"
+)
+
+// Ref types: what kind of object a repo's ref names.
+const (
+	RefBranch = "branch"
+	RefTag    = "tag"
+	RefCommit = "commit"
+)
+
 // Profile selects a subset of repos by tags or explicit IDs.
 type Profile struct {
 	IncludeTags    []string `yaml:"include_tags,omitempty"`
@@ -33,6 +74,7 @@ type Repo struct {
 	URL          string     `yaml:"url,omitempty"`
 	Path         string     `yaml:"path"`
 	Ref          string     `yaml:"ref,omitempty"`
+	RefType      string     `yaml:"ref_type,omitempty"`
 	BaseRef      string     `yaml:"base_ref,omitempty"`
 	Local        bool       `yaml:"local,omitempty"`
 	Tags         []string   `yaml:"tags,omitempty"`
@@ -40,6 +82,9 @@ type Repo struct {
 	Depth        *int       `yaml:"depth,omitempty"`
 	PartialClone *bool      `yaml:"partial_clone,omitempty"`
 	Sparse       []string   `yaml:"sparse,omitempty"`
+	SparseCone   *bool      `yaml:"sparse_cone,omitempty"`
+	Submodules   string     `yaml:"submodules,omitempty"`
+	LFS          *bool      `yaml:"lfs,omitempty"`
 	PostSync     []PostSync `yaml:"post_sync,omitempty"`
 }
 
@@ -71,6 +116,38 @@ func (r *Repo) EffectivePartialClone(d Defaults) bool {
 	return d.PartialClone
 }
 
+// SparseEnabled reports whether the repo uses sparse checkout, i.e. lists
+// sparse paths.
+func (r *Repo) SparseEnabled() bool {
+	return len(r.Sparse) > 0
+}
+
+// SparseConeMode reports whether sparse paths are directories (cone mode,
+// the default) rather than gitignore-style patterns.
+func (r *Repo) SparseConeMode() bool {
+	return r.SparseCone == nil || *r.SparseCone
+}
+
+// EffectiveSubmodules returns the submodule mode for this repo, falling back
+// to defaults and then to none.
+func (r *Repo) EffectiveSubmodules(d Defaults) string {
+	if r.Submodules != "" {
+		return r.Submodules
+	}
+	if d.Submodules != "" {
+		return d.Submodules
+	}
+	return SubmodulesNone
+}
+
+// EffectiveLFS returns the lfs setting, falling back to defaults.
+func (r *Repo) EffectiveLFS(d Defaults) bool {
+	if r.LFS != nil {
+		return *r.LFS
+	}
+	return d.LFS
+}
+
 // EffectiveBaseRef returns the base_ref for this repo, falling back to defaults.
 // Returns empty string if neither repo nor defaults specifies base_ref.
 func (r *Repo) EffectiveBaseRef(d Defaults) string {
@@ -80,12 +157,47 @@ func (r *Repo) EffectiveBaseRef(d Defaults) string {
 	return d.BaseRef
 }
 
-// EffectiveRef returns the ref for this repo, defaulting to "main".
+// DefaultRef is the ref assumed when ref is empty and the repository's
+// default branch cannot be detected.
+const DefaultRef = "main"
+
+// EffectiveRef returns the ref for this repo, defaulting to DefaultRef.
+// Callers with access to the clone should first fill in an empty ref with
+// the repository's default branch.
 func (r *Repo) EffectiveRef() string {
 	if r.Ref != "" {
 		return r.Ref
 	}
-	return "main"
+	return DefaultRef
+}
+
+// DeclaredRefType returns ref_type if set, RefCommit if ref is a full commit
+// SHA, and otherwise "" (branch or tag, to be detected from the clone).
+func (r *Repo) DeclaredRefType() string {
+	if r.RefType != "" {
+		return r.RefType
+	}
+	if IsFullSHA(r.Ref) {
+		return RefCommit
+	}
+	return ""
+}
+
+// IsFullSHA reports whether s is a full SHA-1 or SHA-256 object name.
+func IsFullSHA(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	return isHex(s)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return s != ""
 }
 
 // IsRequired returns whether this repo is required (default true).
@@ -48,6 +48,15 @@ func Parse(data []byte) (*Workspace, error) {
 	return &ws, nil
 }
 
+// Deprecations describes settings in the manifest that are no longer used.
+func (ws *Workspace) Deprecations() []string {
+	var msgs []string
+	if ws.Defaults.SparseCheckout != nil {
+		msgs = append(msgs, "defaults.sparse_checkout is deprecated and ignored; list sparse paths on a repo to check it out sparsely")
+	}
+	return msgs
+}
+
 func validate(ws *Workspace) error {
 	if ws.Version != 1 {
 		return fmt.Errorf("unsupported manifest version: %d (expected 1)", ws.Version)
@@ -59,6 +68,17 @@ func validate(ws *Workspace) error {
 	if err := validateBaseRef(ws.Defaults.BaseRef, "defaults.base_ref"); err != nil {
 		return err
 	}
+	if err := ValidateUpdateMode(ws.Defaults.Update); err != nil {
+		return fmt.Errorf("manifest: defaults.update: %w", err)
+	}
+	if err := validateSubmodules(ws.Defaults.Submodules); err != nil {
+		return fmt.Errorf("manifest: defaults.submodules: %w", err)
+	}
+	for host, n := range ws.Defaults.HostLimits {
+		if host == "" || n < 1 {
+			return fmt.Errorf("manifest: defaults.host_limits: %q must be a host name with a limit >= 1 (got %d)", host, n)
+		}
+	}
 
 	seen := make(map[string]bool, len(ws.Repos))
 	for i, r := range ws.Repos {
@@ -102,6 +122,12 @@ func validateRepo(i int, r Repo, seen map[string]bool) error {
 	if err := validateBaseRef(r.BaseRef, fmt.Sprintf("repos[%d] (%s).base_ref", i, r.ID)); err != nil {
 		return err
 	}
+	if err := validateSubmodules(r.Submodules); err != nil {
+		return fmt.Errorf("manifest: repos[%d] (%s).submodules: %w", i, r.ID, err)
+	}
+	if err := validateRefType(r); err != nil {
+		return fmt.Errorf("manifest: repos[%d] (%s).ref_type: %w", i, r.ID, err)
+	}
 	for j, ps := range r.PostSync {
 		if len(ps.Cmd) == 0 {
 			return fmt.Errorf("manifest: repos[%d] (%s).post_sync[%d].cmd is required", i, r.ID, j)
@@ -116,6 +142,41 @@ func validateRepo(i int, r Repo, seen map[string]bool) error {
 	return nil
 }
 
+// ValidateUpdateMode checks that mode is empty or one of ff-only, rebase, none.
+func ValidateUpdateMode(mode string) error {
+	switch mode {
+	case "", UpdateFFOnly, UpdateRebase, UpdateNone:
+		return nil
+	default:
+		return fmt.Errorf("unknown update mode %q (must be ff-only, rebase, or none)", mode)
+	}
+}
+
+// validateSubmodules checks that mode is empty or one of recursive, shallow, none.
+func validateSubmodules(mode string) error {
+	switch mode {
+	case "", SubmodulesRecursive, SubmodulesShallow, SubmodulesNone:
+		return nil
+	default:
+		return fmt.Errorf("unknown submodules mode %q (must be recursive, shallow, or none)", mode)
+	}
+}
+
+// validateRefType checks ref_type and that commit refs are hex object names.
+func validateRefType(r Repo) error {
+	switch r.RefType {
+	case "", RefBranch, RefTag:
+		return nil
+	case RefCommit:
+		if len(r.Ref) < 7 || !isHex(r.Ref) {
+			return fmt.Errorf("ref %q is not a commit SHA", r.Ref)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown ref type %q (must be branch, tag, or commit)", r.RefType)
+	}
+}
+
 // validateBaseRef ensures a base_ref is a branch name only (no origin/ or refs/ prefix).
 func validateBaseRef(v, label string) error {
 	if v == "" {
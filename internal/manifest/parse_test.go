@@ -1,8 +1,10 @@
 package manifest
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -547,3 +549,189 @@ func TestSave_roundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestParse_updateMode(t *testing.T) {
+	for _, mode := range []string{"ff-only", "rebase", "none"} {
+		data := []byte(`
+version: 1
+name: foo
+defaults:
+  update: ` + mode + `
+repos: []
+`)
+		ws, err := Parse(data)
+		if err != nil {
+			t.Fatalf("update %q: unexpected error: %v", mode, err)
+		}
+		if ws.Defaults.EffectiveUpdate() != mode {
+			t.Errorf("EffectiveUpdate() = %q, want %q", ws.Defaults.EffectiveUpdate(), mode)
+		}
+	}
+
+	if (Defaults{}).EffectiveUpdate() != UpdateFFOnly {
+		t.Error("default update mode should be ff-only")
+	}
+
+	_, err := Parse([]byte(`
+version: 1
+name: foo
+defaults:
+  update: merge
+repos: []
+`))
+	if err == nil {
+		t.Fatal("expected error for unknown update mode")
+	}
+}
+
+func TestParse_submodulesAndLFS(t *testing.T) {
+	ws, err := Parse([]byte(`
+version: 1
+name: foo
+defaults:
+  submodules: shallow
+repos:
+  - id: a
+    url: git@example.com:a.git
+    path: repos/a
+    submodules: recursive
+    lfs: true
+  - id: b
+    url: git@example.com:b.git
+    path: repos/b
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a, b := ws.Repos[0], ws.Repos[1]
+	if got := a.EffectiveSubmodules(ws.Defaults); got != SubmodulesRecursive {
+		t.Errorf("a: submodules = %q, want recursive", got)
+	}
+	if got := b.EffectiveSubmodules(ws.Defaults); got != SubmodulesShallow {
+		t.Errorf("b: submodules = %q, want shallow (from defaults)", got)
+	}
+	if !a.EffectiveLFS(ws.Defaults) || b.EffectiveLFS(ws.Defaults) {
+		t.Error("lfs should be enabled for a only")
+	}
+	if got := (&Repo{}).EffectiveSubmodules(Defaults{}); got != SubmodulesNone {
+		t.Errorf("default submodules = %q, want none", got)
+	}
+
+	_, err = Parse([]byte(`
+version: 1
+name: foo
+repos:
+  - id: a
+    url: git@example.com:a.git
+    path: repos/a
+    submodules: all
+`))
+	if err == nil {
+		t.Fatal("expected error for unknown submodules mode")
+	}
+}
+
+func TestParse_refType(t *testing.T) {
+	ws, err := Parse([]byte(`
+version: 1
+name: foo
+repos:
+  - id: a
+    url: git@example.com:a.git
+    path: repos/a
+    ref: v1.4.2
+    ref_type: tag
+  - id: b
+    url: git@example.com:b.git
+    path: repos/b
+    ref: 0123456789abcdef0123456789abcdef01234567
+  - id: c
+    url: git@example.com:c.git
+    path: repos/c
+    ref: develop
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, want := range []string{RefTag, RefCommit, ""} {
+		if got := ws.Repos[i].DeclaredRefType(); got != want {
+			t.Errorf("%s: ref type = %q, want %q", ws.Repos[i].ID, got, want)
+		}
+	}
+
+	for _, tc := range []struct{ ref, refType string }{
+		{"main", "bogus"},
+		{"main", "commit"},
+		{"abc", "commit"},
+	} {
+		_, err := Parse([]byte(fmt.Sprintf(`
+version: 1
+name: foo
+repos:
+  - id: a
+    url: git@example.com:a.git
+    path: repos/a
+    ref: %s
+    ref_type: %s
+`, tc.ref, tc.refType)))
+		if err == nil || !strings.Contains(err.Error(), "ref_type") {
+			t.Errorf("ref %q ref_type %q: expected ref_type error, got %v", tc.ref, tc.refType, err)
+		}
+	}
+}
+
+func TestParse_hostLimits(t *testing.T) {
+	ws, err := Parse([]byte(`
+version: 1
+name: foo
+defaults:
+  host_limits:
+    github.com: 4
+    gitlab.internal: 16
+repos:
+  - id: a
+    url: git@github.com:org/a.git
+    path: repos/a
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := ws.Defaults.HostLimits["github.com"]; got != 4 {
+		t.Errorf("github.com limit = %d, want 4", got)
+	}
+
+	_, err = Parse([]byte(`
+version: 1
+name: foo
+defaults:
+  host_limits:
+    github.com: 0
+repos: []
+`))
+	if err == nil || !strings.Contains(err.Error(), "host_limits") {
+		t.Errorf("expected host_limits error, got %v", err)
+	}
+}
+
+func TestWorkspace_Deprecations(t *testing.T) {
+	ws, err := Parse([]byte(`version: 1
+name: test
+defaults:
+  sparse_checkout: false
+repos: []
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ws.Deprecations(); len(got) != 1 || !strings.Contains(got[0], "defaults.sparse_checkout") {
+		t.Errorf("Deprecations() = %v, want a sparse_checkout warning", got)
+	}
+
+	ws, err = Parse([]byte("version: 1\nname: test\nrepos: []\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ws.Deprecations(); len(got) != 0 {
+		t.Errorf("Deprecations() = %v, want none", got)
+	}
+}
@@ -69,6 +69,12 @@ func CreateBareRepoWithBranch(t *testing.T, branch string) string {
 // PushNewCommit creates a new commit in a bare repo by cloning it into a
 // temporary working directory, committing a new file, and pushing back.
 func PushNewCommit(t *testing.T, bareRepo string) {
+	t.Helper()
+	PushNewCommits(t, bareRepo, 1)
+}
+
+// PushNewCommits pushes n new commits to a bare repo, each adding a new file.
+func PushNewCommits(t *testing.T, bareRepo string, n int) {
 	t.Helper()
 	dir := t.TempDir()
 	work := filepath.Join(dir, "pushwork")
@@ -76,12 +82,18 @@ func PushNewCommit(t *testing.T, bareRepo string) {
 	run(t, work, "git", "config", "user.email", "test@example.com")
 	run(t, work, "git", "config", "user.name", "Test")
 
-	f := filepath.Join(work, "newfile.txt")
-	if err := os.WriteFile(f, []byte("new content\n"), 0644); err != nil {
-		t.Fatal(err)
+	for range n {
+		f, err := os.CreateTemp(work, "newfile-*.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString("new content\n"); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+		run(t, work, "git", "add", ".")
+		run(t, work, "git", "commit", "-m", "new commit")
 	}
-	run(t, work, "git", "add", ".")
-	run(t, work, "git", "commit", "-m", "new commit")
 	run(t, work, "git", "push")
 }
 
@@ -95,3 +107,29 @@ func run(t *testing.T, dir string, name string, args ...string) {
 		t.Fatalf("command %s %v failed: %v", name, args, err)
 	}
 }
+
+// AllowFileSubmodules lets git clone submodules from local paths for the rest
+// of the test (git blocks the file protocol for submodules by default).
+func AllowFileSubmodules(t *testing.T) {
+	t.Helper()
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "protocol.file.allow")
+	t.Setenv("GIT_CONFIG_VALUE_0", "always")
+}
+
+// CreateBareRepoWithSubmodule creates a bare repo whose main branch has the
+// bare repo sub registered as a submodule at path.
+func CreateBareRepoWithSubmodule(t *testing.T, sub, path string) string {
+	t.Helper()
+	AllowFileSubmodules(t)
+	bare := CreateBareRepo(t)
+
+	work := filepath.Join(t.TempDir(), "subwork")
+	run(t, ".", "git", "clone", bare, work)
+	run(t, work, "git", "config", "user.email", "test@example.com")
+	run(t, work, "git", "config", "user.name", "Test")
+	run(t, work, "git", "submodule", "add", sub, path)
+	run(t, work, "git", "commit", "-m", "add submodule")
+	run(t, work, "git", "push")
+	return bare
+}
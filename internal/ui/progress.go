@@ -1,36 +1,195 @@
 package ui
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
-// Progress tracks completion of parallel tasks with a simple counter display.
+// Event types emitted by an NDJSON progress sink.
+const (
+	EventRepoStarted  = "repo_started"
+	EventCloning      = "cloning"
+	EventFetched      = "fetched"
+	EventCheckedOut   = "checked_out"
+	EventHookStarted  = "hook_started"
+	EventHookFinished = "hook_finished"
+	EventSkipped      = "skipped"
+	EventFailed       = "failed"
+	EventDone         = "done"
+	EventLog          = "log"
+)
+
+// Event is a single state transition written as one JSON line in NDJSON mode.
+type Event struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Repo       string    `json:"repo,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS *int64    `json:"duration_ms,omitempty"`
+	Completed  int       `json:"completed,omitempty"`
+	Total      int       `json:"total,omitempty"`
+}
+
+// Progress tracks completion of parallel tasks. By default it prints a simple
+// counter display; NewNDJSONProgress creates a sink that emits one JSON event
+// per state transition instead. All methods are safe for concurrent use and
+// are no-ops on a nil *Progress.
 type Progress struct {
 	out       io.Writer
 	total     int
 	completed atomic.Int32
 	mu        sync.Mutex
+	ndjson    bool
+	starts    map[string]time.Time
 }
 
-// NewProgress creates a progress tracker for n tasks.
+// NewProgress creates a text progress tracker for n tasks.
 func NewProgress(out io.Writer, total int) *Progress {
-	return &Progress{out: out, total: total}
+	return &Progress{out: out, total: total, starts: make(map[string]time.Time)}
+}
+
+// NewNDJSONProgress creates a progress tracker for n tasks that writes
+// newline-delimited JSON events to out.
+func NewNDJSONProgress(out io.Writer, total int) *Progress {
+	p := NewProgress(out, total)
+	p.ndjson = true
+	return p
 }
 
 // Done marks one task as completed and prints the current progress.
 func (p *Progress) Done(label string) {
-	n := int(p.completed.Add(1))
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	_, _ = fmt.Fprintf(p.out, "[%d/%d] %s\n", n, p.total, label)
+	p.Finish("", EventDone, label, nil)
 }
 
 // Log prints an informational message within the progress context.
 func (p *Progress) Log(format string, args ...any) {
+	if p == nil {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ndjson {
+		p.emit(Event{Type: EventLog, Message: msg})
+		return
+	}
+	_, _ = fmt.Fprintln(p.out, msg)
+}
+
+// Start records that work on repo has begun. Durations of later events for
+// the repo are measured from this point.
+func (p *Progress) Start(repo string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.starts[repo] = time.Now()
+	if p.ndjson {
+		p.emit(Event{Type: EventRepoStarted, Repo: repo, Total: p.total})
+	}
+}
+
+// Step reports an intermediate state transition for repo. In text mode msg is
+// printed like Log (nothing is printed if msg is empty).
+func (p *Progress) Step(repo, typ, msg string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ndjson {
+		p.emit(Event{Type: typ, Repo: repo, Message: msg, DurationMS: p.since(repo)})
+		return
+	}
+	if msg != "" {
+		_, _ = fmt.Fprintln(p.out, msg)
+	}
+}
+
+// Timed reports a step with its own duration (e.g. a finished hook). Nothing
+// is printed in text mode.
+func (p *Progress) Timed(repo, typ, msg string, d time.Duration, err error) {
+	if p == nil || !p.ndjson {
+		return
+	}
+	ms := d.Milliseconds()
+	e := Event{Type: typ, Repo: repo, Message: msg, DurationMS: &ms}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emit(e)
+}
+
+// Finish marks the task for repo as completed with the given terminal event
+// type (done, skipped or failed). In text mode it prints "[n/total] label".
+func (p *Progress) Finish(repo, typ, label string, err error) {
+	if p == nil {
+		return
+	}
+	n := int(p.completed.Add(1))
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	_, _ = fmt.Fprintf(p.out, format+"\n", args...)
+	if p.ndjson {
+		e := Event{Type: typ, Repo: repo, Message: label, DurationMS: p.since(repo), Completed: n, Total: p.total}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		p.emit(e)
+		return
+	}
+	_, _ = fmt.Fprintf(p.out, "[%d/%d] %s\n", n, p.total, label)
+}
+
+// Writer returns a writer for output printed between progress lines, such as
+// the output of hooks. Writes are serialized with the progress output. In
+// text mode they go to the progress output; in NDJSON mode, which reserves
+// that for events, they go to w.
+func (p *Progress) Writer(w io.Writer) io.Writer {
+	if p == nil {
+		return w
+	}
+	if !p.ndjson {
+		w = p.out
+	}
+	return &progressWriter{p: p, w: w}
+}
+
+type progressWriter struct {
+	p *Progress
+	w io.Writer
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	pw.p.mu.Lock()
+	defer pw.p.mu.Unlock()
+	return pw.w.Write(b)
+}
+
+// since returns the milliseconds elapsed since Start(repo), or nil if the
+// repo was never started. Callers must hold p.mu.
+func (p *Progress) since(repo string) *int64 {
+	start, ok := p.starts[repo]
+	if !ok {
+		return nil
+	}
+	ms := time.Since(start).Milliseconds()
+	return &ms
+}
+
+// emit writes e as a single JSON line. Callers must hold p.mu.
+func (p *Progress) emit(e Event) {
+	e.Time = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	_, _ = p.out.Write(append(data, '\n'))
 }
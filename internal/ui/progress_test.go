@@ -2,8 +2,11 @@ package ui
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestProgress_Done(t *testing.T) {
@@ -37,3 +40,85 @@ func TestProgress_Log(t *testing.T) {
 		t.Errorf("missing log message: %s", out)
 	}
 }
+
+func TestProgress_textStepAndFinish(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewProgress(&buf, 1)
+
+	p.Start("backend")
+	p.Step("backend", EventCloning, "Cloning backend ...")
+	p.Step("backend", EventFetched, "")
+	p.Timed("backend", EventHookFinished, "build", time.Second, nil)
+	p.Finish("backend", EventDone, "backend synced @ main", nil)
+
+	want := "Cloning backend ...\n[1/1] backend synced @ main\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestProgress_ndjson(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewNDJSONProgress(&buf, 2)
+
+	p.Start("backend")
+	p.Step("backend", EventCloning, "Cloning backend ...")
+	p.Timed("backend", EventHookFinished, "build", 1500*time.Millisecond, nil)
+	p.Finish("backend", EventDone, "backend synced @ main", nil)
+	p.Start("frontend")
+	p.Finish("frontend", EventFailed, "frontend failed", errors.New("boom"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 events, got %d: %s", len(lines), buf.String())
+	}
+	events := make([]Event, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &events[i]); err != nil {
+			t.Fatalf("line %d is not JSON: %v: %s", i, err, line)
+		}
+		if events[i].Time.IsZero() {
+			t.Errorf("event %d has no timestamp", i)
+		}
+	}
+
+	types := []string{EventRepoStarted, EventCloning, EventHookFinished, EventDone, EventRepoStarted, EventFailed}
+	for i, typ := range types {
+		if events[i].Type != typ {
+			t.Errorf("event %d: type = %q, want %q", i, events[i].Type, typ)
+		}
+	}
+	if events[2].DurationMS == nil || *events[2].DurationMS != 1500 {
+		t.Errorf("hook_finished should carry its own duration: %+v", events[2])
+	}
+	if events[3].DurationMS == nil || events[3].Completed != 1 || events[3].Total != 2 {
+		t.Errorf("done event missing duration or counters: %+v", events[3])
+	}
+	if events[5].Repo != "frontend" || events[5].Error != "boom" || events[5].Completed != 2 {
+		t.Errorf("unexpected failed event: %+v", events[5])
+	}
+}
+
+func TestProgress_Writer(t *testing.T) {
+	var out, other bytes.Buffer
+	p := NewProgress(&out, 1)
+	_, _ = p.Writer(&other).Write([]byte("hook output\n"))
+	if out.String() != "hook output\n" || other.Len() != 0 {
+		t.Errorf("text mode should write to the progress output, got %q / %q", out.String(), other.String())
+	}
+
+	out.Reset()
+	p = NewNDJSONProgress(&out, 1)
+	_, _ = p.Writer(&other).Write([]byte("hook output\n"))
+	if out.Len() != 0 || other.String() != "hook output\n" {
+		t.Errorf("NDJSON mode should keep the event stream clean, got %q / %q", out.String(), other.String())
+	}
+}
+
+func TestProgress_nilIsNoop(t *testing.T) {
+	var p *Progress
+	p.Start("backend")
+	p.Step("backend", EventFetched, "")
+	p.Log("ignored")
+	p.Finish("backend", EventDone, "ignored", nil)
+}
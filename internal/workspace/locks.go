@@ -0,0 +1,161 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fbkclanna/agentws/internal/lock"
+)
+
+// LocksDir is the workspace-relative directory holding named and archived locks.
+const LocksDir = ".agentws/locks"
+
+// lockSuffix is the file suffix shared by all lock files.
+const lockSuffix = ".lock.yaml"
+
+// NamedLock describes a lock file stored under LocksDir.
+type NamedLock struct {
+	Name string
+	Path string
+}
+
+// LockNamePath returns the path of the named lock (e.g. "release-2.3" →
+// .agentws/locks/release-2.3.lock.yaml). The ".lock.yaml" suffix is optional.
+func (c *Context) LockNamePath(name string) (string, error) {
+	name = strings.TrimSuffix(name, lockSuffix)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid lock name %q: must be a simple file name", name)
+	}
+	return filepath.Join(c.Root, LocksDir, name+lockSuffix), nil
+}
+
+// ResolveLockPath returns the lock path selected by --lock-name or --lock-file.
+// A relative --lock-file is resolved against the workspace root. When neither
+// is set, the default LockFile is returned.
+func (c *Context) ResolveLockPath(name, file string) (string, error) {
+	switch {
+	case name != "" && file != "":
+		return "", fmt.Errorf("--lock-name and --lock-file are mutually exclusive")
+	case name != "":
+		return c.LockNamePath(name)
+	case file != "":
+		if filepath.IsAbs(file) {
+			return file, nil
+		}
+		return filepath.Join(c.Root, file), nil
+	default:
+		return filepath.Join(c.Root, LockFile), nil
+	}
+}
+
+// UseLock switches the context to the lock file at path, loading it if it
+// exists. Lock is set to nil when the file does not exist.
+func (c *Context) UseLock(path string) error {
+	c.LockPath = path
+	c.Lock = nil
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	lf, err := lock.Load(path)
+	if err != nil {
+		return err
+	}
+	c.Lock = lf
+	return nil
+}
+
+// ListLocks returns the named locks under LocksDir sorted by name.
+func (c *Context) ListLocks() ([]NamedLock, error) {
+	dir := filepath.Join(c.Root, LocksDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading locks directory: %w", err)
+	}
+	var locks []NamedLock
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), lockSuffix) {
+			continue
+		}
+		locks = append(locks, NamedLock{
+			Name: strings.TrimSuffix(e.Name(), lockSuffix),
+			Path: filepath.Join(dir, e.Name()),
+		})
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Name < locks[j].Name })
+	return locks, nil
+}
+
+// ArchiveLock copies the lock at path into LocksDir as
+// "<name>.<timestamp>.lock.yaml", using the lock's generated_at (or the file
+// modification time) as the timestamp. An existing archive is never
+// overwritten: locks with the same timestamp get a "-2", "-3", ... suffix.
+// It returns the archive name, or an empty string if there is no lock at path
+// to archive.
+func (c *Context) ArchiveLock(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("reading lock file: %w", err)
+	}
+
+	ts := lockTimestamp(path, data)
+	base := filepath.Base(path)
+	if strings.HasSuffix(base, lockSuffix) {
+		base = strings.TrimSuffix(base, lockSuffix)
+	} else {
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	stem := base + "." + ts.UTC().Format("20060102T150405Z")
+
+	if err := os.MkdirAll(filepath.Join(c.Root, LocksDir), 0755); err != nil {
+		return "", fmt.Errorf("creating locks directory: %w", err)
+	}
+	for n := 1; ; n++ {
+		name := stem
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d", stem, n)
+		}
+		dest, err := c.LockNamePath(name)
+		if err != nil {
+			return "", err
+		}
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("writing archived lock: %w", err)
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return "", fmt.Errorf("writing archived lock: %w", err)
+		}
+		return name, nil
+	}
+}
+
+// lockTimestamp returns the generated_at time recorded in a lock, falling back
+// to the file modification time when it is missing or unparsable.
+func lockTimestamp(path string, data []byte) time.Time {
+	if lf, err := lock.Parse(data); err == nil {
+		if ts, err := time.Parse(time.RFC3339, lf.GeneratedAt); err == nil {
+			return ts
+		}
+	}
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
@@ -0,0 +1,115 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fbkclanna/agentws/internal/lock"
+)
+
+func TestResolveLockPath(t *testing.T) {
+	ctx := &Context{Root: "/ws"}
+
+	tests := []struct {
+		name, lockName, lockFile, want string
+		wantErr                        bool
+	}{
+		{name: "default", want: "/ws/workspace.lock.yaml"},
+		{name: "named", lockName: "release-2.3", want: "/ws/.agentws/locks/release-2.3.lock.yaml"},
+		{name: "named with suffix", lockName: "release-2.3.lock.yaml", want: "/ws/.agentws/locks/release-2.3.lock.yaml"},
+		{name: "relative file", lockFile: "locks/x.yaml", want: "/ws/locks/x.yaml"},
+		{name: "absolute file", lockFile: "/tmp/x.yaml", want: "/tmp/x.yaml"},
+		{name: "both", lockName: "a", lockFile: "b", wantErr: true},
+		{name: "name with slash", lockName: "../a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ctx.ResolveLockPath(tt.lockName, tt.lockFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveLockPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != filepath.FromSlash(tt.want) {
+				t.Errorf("ResolveLockPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUseLock(t *testing.T) {
+	dir := t.TempDir()
+	ctx := &Context{Root: dir}
+
+	path := filepath.Join(dir, "other.lock.yaml")
+	if err := ctx.UseLock(path); err != nil {
+		t.Fatalf("UseLock() on missing file: %v", err)
+	}
+	if ctx.Lock != nil || ctx.LockPath != path {
+		t.Errorf("unexpected context after UseLock on missing file: %+v", ctx)
+	}
+
+	if err := lock.Save(path, &lock.File{Version: 1, Name: "x", Repos: map[string]*lock.Repo{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.UseLock(path); err != nil {
+		t.Fatalf("UseLock(): %v", err)
+	}
+	if ctx.Lock == nil || ctx.Lock.Name != "x" {
+		t.Errorf("Lock not loaded: %+v", ctx.Lock)
+	}
+}
+
+func TestArchiveAndListLocks(t *testing.T) {
+	dir := t.TempDir()
+	ctx := &Context{Root: dir}
+
+	name, err := ctx.ArchiveLock(filepath.Join(dir, "workspace.lock.yaml"))
+	if err != nil || name != "" {
+		t.Fatalf("ArchiveLock() on missing file = %q, %v", name, err)
+	}
+
+	lf := &lock.File{Version: 1, Name: "x", GeneratedAt: "2026-09-17T10:20:30+09:00"}
+	if err := lock.Save(filepath.Join(dir, "workspace.lock.yaml"), lf); err != nil {
+		t.Fatal(err)
+	}
+	name, err = ctx.ArchiveLock(filepath.Join(dir, "workspace.lock.yaml"))
+	if err != nil {
+		t.Fatalf("ArchiveLock(): %v", err)
+	}
+	if name != "workspace.20260917T012030Z" {
+		t.Errorf("archive name = %q", name)
+	}
+
+	// A second lock with the same generated_at must not replace the first.
+	first, _ := ctx.LockNamePath(name)
+	lf2 := &lock.File{Version: 1, Name: "y", GeneratedAt: lf.GeneratedAt}
+	if err := lock.Save(filepath.Join(dir, "workspace.lock.yaml"), lf2); err != nil {
+		t.Fatal(err)
+	}
+	name, err = ctx.ArchiveLock(filepath.Join(dir, "workspace.lock.yaml"))
+	if err != nil || name != "workspace.20260917T012030Z-2" {
+		t.Fatalf("second ArchiveLock() = %q, %v", name, err)
+	}
+	if got, err := lock.Load(first); err != nil || got.Name != "x" {
+		t.Errorf("first archive was overwritten: %+v, %v", got, err)
+	}
+
+	named, _ := ctx.LockNamePath("release-2.3")
+	if err := lock.Save(named, lf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, LocksDir, "notes.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	locks, err := ctx.ListLocks()
+	if err != nil {
+		t.Fatalf("ListLocks(): %v", err)
+	}
+	if len(locks) != 3 {
+		t.Fatalf("ListLocks() returned %d locks, want 3", len(locks))
+	}
+	if locks[0].Name != "release-2.3" || locks[1].Name != "workspace.20260917T012030Z" || locks[2].Name != "workspace.20260917T012030Z-2" {
+		t.Errorf("unexpected lock names: %+v", locks)
+	}
+}
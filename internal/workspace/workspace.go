@@ -9,6 +9,12 @@ import (
 	"github.com/fbkclanna/agentws/internal/manifest"
 )
 
+// File names of the manifest and the default lock in the workspace root.
+const (
+	ManifestFile = "workspace.yaml"
+	LockFile     = "workspace.lock.yaml"
+)
+
 // Context holds the resolved paths and loaded config for a workspace.
 type Context struct {
 	Root         string
@@ -25,8 +31,8 @@ func Load(root string) (*Context, error) {
 		return nil, fmt.Errorf("resolving workspace root: %w", err)
 	}
 
-	manifestPath := filepath.Join(root, "workspace.yaml")
-	lockPath := filepath.Join(root, "workspace.lock.yaml")
+	manifestPath := filepath.Join(root, ManifestFile)
+	lockPath := filepath.Join(root, LockFile)
 
 	ws, err := manifest.Load(manifestPath)
 	if err != nil {
@@ -78,3 +84,44 @@ func ParseStrategy(s string) (Strategy, error) {
 		return "", fmt.Errorf("unknown strategy: %q (must be safe, stash, or reset)", s)
 	}
 }
+
+// FindUnmanagedRepos walks repos_root and returns the absolute paths of git
+// repositories that no manifest entry points to. Directories belonging to
+// manifest repos are not descended into. Returns nil if repos_root is unset
+// or does not exist.
+func (c *Context) FindUnmanagedRepos() ([]string, error) {
+	if c.Manifest.ReposRoot == "" {
+		return nil, nil
+	}
+	reposRoot := filepath.Join(c.Root, c.Manifest.ReposRoot)
+	if _, err := os.Stat(reposRoot); err != nil {
+		return nil, nil
+	}
+
+	managed := make(map[string]bool, len(c.Manifest.Repos))
+	for _, r := range c.Manifest.Repos {
+		managed[c.RepoDir(r)] = true
+	}
+
+	var found []string
+	err := filepath.WalkDir(reposRoot, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == reposRoot {
+			return nil
+		}
+		if managed[path] {
+			return filepath.SkipDir
+		}
+		if _, err := os.Lstat(filepath.Join(path, ".git")); err == nil {
+			found = append(found, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", c.Manifest.ReposRoot, err)
+	}
+	return found, nil
+}
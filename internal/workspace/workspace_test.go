@@ -179,3 +179,55 @@ func TestRepoDir(t *testing.T) {
 		t.Errorf("RepoDir() = %q, want %q", got, want)
 	}
 }
+
+func TestFindUnmanagedRepos(t *testing.T) {
+	dir := t.TempDir()
+	ctx := &Context{
+		Root: dir,
+		Manifest: &manifest.Workspace{
+			ReposRoot: "repos",
+			Repos: []manifest.Repo{
+				{ID: "backend", Path: "repos/backend"},
+				{ID: "nested", Path: "repos/group/nested"},
+			},
+		},
+	}
+
+	for _, p := range []string{
+		"repos/backend/.git",
+		"repos/backend/vendor/lib/.git", // inside a managed repo: ignored
+		"repos/group/nested/.git",
+		"repos/old-svc/.git",
+		"repos/group/legacy/.git",
+		"repos/plain-dir",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, p), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := ctx.FindUnmanagedRepos()
+	if err != nil {
+		t.Fatalf("FindUnmanagedRepos() error: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "repos/group/legacy"),
+		filepath.Join(dir, "repos/old-svc"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("FindUnmanagedRepos() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("FindUnmanagedRepos()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFindUnmanagedRepos_noReposRoot(t *testing.T) {
+	ctx := &Context{Root: t.TempDir(), Manifest: &manifest.Workspace{}}
+	got, err := ctx.FindUnmanagedRepos()
+	if err != nil || got != nil {
+		t.Errorf("FindUnmanagedRepos() = %v, %v; want nil, nil", got, err)
+	}
+}